@@ -1 +1 @@
-go run ../src/piff-view/main.go -filename c61_short.ibdf | less +G -R
+go run ../src/piff-view/main.go c61_short.ibdf | less +G -R
@@ -0,0 +1,120 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/piot/piff-go/src/piff"
+
+	"github.com/piot/log-go/src/clog"
+)
+
+type converter struct {
+	importer func(io.Reader, *piff.OutStream) error
+	exporter func(*piff.InStream, io.Writer) error
+}
+
+var converters = map[string]converter{
+	"riff":       {importer: piff.ImportRIFF, exporter: piff.ExportRIFF},
+	"iff":        {importer: piff.ImportIFF, exporter: piff.ExportIFF},
+	"png":        {importer: piff.ImportPNG, exporter: piff.ExportPNG},
+	"headerless": {importer: piff.ImportHeaderless, exporter: piff.ExportHeaderless},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n  piff-convert -from riff|iff|png|headerless in_file out.piff\n  piff-convert -to riff|iff|png|headerless in.piff out_file\n")
+}
+
+func convertFrom(c converter, inFilename string, outFilename string) error {
+	inFile, openErr := os.Open(inFilename)
+	if openErr != nil {
+		return openErr
+	}
+	defer inFile.Close()
+
+	outStream, outErr := piff.NewOutStream(outFilename)
+	if outErr != nil {
+		return outErr
+	}
+	defer outStream.Close()
+
+	return c.importer(inFile, outStream)
+}
+
+func convertTo(c converter, inFilename string, outFilename string) error {
+	inStream, inErr := piff.NewInStreamFile(inFilename)
+	if inErr != nil {
+		return inErr
+	}
+	defer inStream.Close()
+
+	outFile, createErr := os.Create(outFilename)
+	if createErr != nil {
+		return createErr
+	}
+	defer outFile.Close()
+
+	return c.exporter(inStream, outFile)
+}
+
+func run() error {
+	var from string
+	var to string
+	flag.StringVar(&from, "from", "", "format to convert into piff")
+	flag.StringVar(&to, "to", "", "format to convert piff into")
+	flag.Parse()
+	if flag.NArg() != 2 || (from == "") == (to == "") {
+		usage()
+		os.Exit(1)
+	}
+
+	formatName := from
+	if to != "" {
+		formatName = to
+	}
+	c, isKnown := converters[formatName]
+	if !isKnown {
+		return fmt.Errorf("unknown format '%v'", formatName)
+	}
+	if from != "" {
+		return convertFrom(c, flag.Arg(0), flag.Arg(1))
+	}
+	return convertTo(c, flag.Arg(0), flag.Arg(1))
+}
+
+func main() {
+	log := clog.DefaultLog()
+	err := run()
+	if err != nil {
+		log.Err(err)
+		os.Exit(1)
+	}
+}
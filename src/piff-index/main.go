@@ -0,0 +1,70 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/piot/piff-go/src/piff"
+
+	"github.com/piot/log-go/src/clog"
+)
+
+func index(filename string, force bool) error {
+	if !force && piff.IsSidecarFresh(filename) {
+		fmt.Printf("%v: up to date\n", filename)
+		return nil
+	}
+	if buildErr := piff.BuildSidecar(filename); buildErr != nil {
+		return buildErr
+	}
+	fmt.Printf("%v: wrote %v\n", filename, piff.SidecarFilename(filename))
+	return nil
+}
+
+func main() {
+	log := clog.DefaultLog()
+	var force bool
+	flag.BoolVar(&force, "force", false, "rebuild sidecars that are up to date")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "usage: piff-index [-force] some_file.piff...\n")
+		os.Exit(1)
+	}
+	failed := false
+	for _, filename := range flag.Args() {
+		if err := index(filename, force); err != nil {
+			log.Err(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/piot/piff-go/src/piff"
+
+	"github.com/piot/log-go/src/clog"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n  piff-json export some_file.piff > some_file.jsonl\n  piff-json import some_file.jsonl some_file.piff\n")
+}
+
+func export(piffFilename string) error {
+	inStream, inErr := piff.NewInStreamFile(piffFilename)
+	if inErr != nil {
+		return inErr
+	}
+	defer inStream.Close()
+
+	return piff.ExportJSONLines(inStream, os.Stdout)
+}
+
+func importFile(jsonFilename string, piffFilename string) error {
+	jsonFile, openErr := os.Open(jsonFilename)
+	if openErr != nil {
+		return openErr
+	}
+	defer jsonFile.Close()
+
+	outStream, outErr := piff.NewOutStream(piffFilename)
+	if outErr != nil {
+		return outErr
+	}
+	defer outStream.Close()
+
+	return piff.ImportJSONLines(jsonFile, outStream)
+}
+
+func run() error {
+	flag.Parse()
+	switch {
+	case flag.NArg() == 2 && flag.Arg(0) == "export":
+		return export(flag.Arg(1))
+	case flag.NArg() == 3 && flag.Arg(0) == "import":
+		return importFile(flag.Arg(1), flag.Arg(2))
+	}
+	usage()
+	os.Exit(1)
+	return nil
+}
+
+func main() {
+	log := clog.DefaultLog()
+	err := run()
+	if err != nil {
+		log.Err(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/piot/piff-go/src/piff"
+
+	"github.com/piot/log-go/src/clog"
+)
+
+const (
+	exitOK = iota
+	exitUsage
+	exitBadFileHeader
+	exitUnsupportedVersion
+	exitTruncatedChunk
+	exitTrailingGarbage
+	exitReadError
+)
+
+func exitCodeFromKind(kind piff.ValidationErrorKind) int {
+	switch kind {
+	case piff.ValidationBadFileHeader:
+		return exitBadFileHeader
+	case piff.ValidationUnsupportedVersion:
+		return exitUnsupportedVersion
+	case piff.ValidationTruncatedChunk:
+		return exitTruncatedChunk
+	case piff.ValidationTrailingGarbage:
+		return exitTrailingGarbage
+	}
+	return exitReadError
+}
+
+func options() (string, piff.FileFormat, error) {
+	var formatName string
+	flag.StringVar(&formatName, "format", "auto", "file format: auto, piff or headerless")
+	flag.Parse()
+	format, formatErr := piff.ParseFileFormat(formatName)
+	if formatErr != nil || flag.NArg() < 1 {
+		return "", format, formatErr
+	}
+	return flag.Arg(0), format, nil
+}
+
+func run(filename string, format piff.FileFormat) (piff.ValidationReport, error) {
+	file, openErr := os.Open(filename)
+	if openErr != nil {
+		return piff.ValidationReport{}, openErr
+	}
+	defer file.Close()
+
+	return piff.ValidateWithFormat(file, format)
+}
+
+func main() {
+	log := clog.DefaultLog()
+	filename, format, optionsErr := options()
+	if optionsErr != nil || filename == "" {
+		if optionsErr != nil {
+			log.Err(optionsErr)
+		}
+		fmt.Fprintf(os.Stderr, "usage: piff-verify [-format auto|piff|headerless] some_file.piff\n")
+		os.Exit(exitUsage)
+	}
+	report, err := run(filename, format)
+	if err != nil {
+		log.Err(err)
+		validationErr, wasValidationErr := err.(*piff.ValidationError)
+		if !wasValidationErr {
+			os.Exit(exitReadError)
+		}
+		os.Exit(exitCodeFromKind(validationErr.Kind))
+	}
+	fmt.Printf("%v: ok, %v, %d chunks, %d octets\n", filename, report.Format, report.ChunkCount, report.OctetCount)
+	os.Exit(exitOK)
+}
@@ -27,13 +27,17 @@ SOFTWARE.
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/piot/piff-go/src/piff"
+	"github.com/piot/piff-go/src/schema"
 
 	"github.com/fatih/color"
 
@@ -42,16 +46,29 @@ import (
 	"github.com/piot/log-go/src/clog"
 )
 
-func options() string {
-	//var piffFile string
-	//	flag.StringVar(&piffFile, "filename", "", "file to view")
+type viewOptions struct {
+	filename string
+	format   piff.FileFormat
+	tail     int
+}
+
+func options() (viewOptions, error) {
+	var formatName string
+	var o viewOptions
+	flag.StringVar(&formatName, "format", "auto", "file format: auto, piff or headerless")
+	flag.IntVar(&o.tail, "tail", 0, "only show the last N chunks")
 	flag.Parse()
+	format, formatErr := piff.ParseFileFormat(formatName)
+	if formatErr != nil {
+		return o, formatErr
+	}
+	o.format = format
 	count := flag.NArg()
 	if count < 1 {
-		return ""
+		return o, nil
 	}
-	ibdfFilename := flag.Arg(0)
-	return ibdfFilename
+	o.filename = flag.Arg(0)
+	return o, nil
 }
 
 func openReadSeeker(filename string) (io.ReadSeeker, error) {
@@ -69,26 +86,272 @@ func openReadSeeker(filename string) (io.ReadSeeker, error) {
 	return seekerToUse, nil
 }
 
-func run(filename string, log *clog.Log) error {
-	seekerToUse, seekerErr := openReadSeeker(filename)
+func printMetadata(metadata map[string]string, metadataErr error) {
+	if metadataErr != nil {
+		color.Red("-- metadata: %v\n", metadataErr)
+		return
+	}
+	if metadata == nil {
+		return
+	}
+	color.Green("-- metadata\n")
+	for _, key := range piff.SortedMetadataKeys(metadata) {
+		color.Green("  %v: %v\n", key, metadata[key])
+	}
+}
+
+func printBinary(payload []byte) {
+	color.Cyan("%v\n", hex.Dump(payload))
+	base64String := base64.StdEncoding.EncodeToString(payload)
+	color.Blue("%v\n", base64String)
+}
+
+func printJSON(payload []byte) {
+	var indented bytes.Buffer
+	indentErr := json.Indent(&indented, payload, "", "  ")
+	if indentErr != nil {
+		printBinary(payload)
+		return
+	}
+	color.Cyan("%v\n", indented.String())
+}
+
+func printTimestamp(payload []byte) {
+	timestamp, timestampErr := piff.TimestampFromOctets(payload)
+	if timestampErr != nil {
+		printBinary(payload)
+		return
+	}
+	color.Yellow("  %v\n", timestamp)
+}
+
+func printMetadataChunk(payload []byte) {
+	metadata, metadataErr := piff.MetadataFromOctets(payload)
+	if metadataErr != nil {
+		printBinary(payload)
+		return
+	}
+	for _, key := range piff.SortedMetadataKeys(metadata) {
+		color.Green("  %v: %v\n", key, metadata[key])
+	}
+}
+
+func printRegistry(payload []byte) {
+	registry, registryErr := piff.NewTypeRegistryFromOctets(payload)
+	if registryErr != nil {
+		printBinary(payload)
+		return
+	}
+	for _, info := range registry.Infos() {
+		color.Green("  %v %v (%v): %v\n", info.TypeID, info.Name, info.Encoding, info.Description)
+	}
+}
+
+func printSchema(payload []byte) {
+	s, schemaErr := schema.ParseAndValidate(string(payload))
+	if schemaErr != nil {
+		color.Red("%v\n", schemaErr)
+		color.Cyan("%v\n", string(payload))
+		return
+	}
+	color.Cyan("%v", schema.Format(s))
+}
+
+func printPacket(payload []byte) {
+	header, body, decodeErr := schema.DecodePacketHeader(payload)
+	if decodeErr != nil {
+		color.Red("%v\n", decodeErr)
+		printBinary(payload)
+		return
+	}
+	color.Cyan("%v\n", header)
+	printBinary(body)
+}
+
+func printChunk(registry *piff.TypeRegistry, header piff.InHeader, payload []byte) {
+	info, isKnown := registry.Lookup(header.TypeID())
+	label := header.TypeIDString()
+	if isKnown && info.Name != "" {
+		label = fmt.Sprintf("%v (%v)", label, info.Name)
+	}
+	fmt.Printf("-- %v: octetCount:%v index:%v\n", label, header.OctetCount(), header.ChunkIndex())
+
+	if header.TypeIDString() == schema.TypeIDString {
+		printSchema(payload)
+		return
+	}
+	if header.TypeIDString() == schema.PacketTypeIDString {
+		printPacket(payload)
+		return
+	}
+
+	switch info.Encoding {
+	case piff.PayloadEncodingText:
+		color.Cyan("%v\n", string(payload))
+	case piff.PayloadEncodingJSON:
+		printJSON(payload)
+	case piff.PayloadEncodingTimestamp:
+		printTimestamp(payload)
+	case piff.PayloadEncodingMetadata:
+		printMetadataChunk(payload)
+	case piff.PayloadEncodingRegistry:
+		printRegistry(payload)
+	default:
+		printBinary(payload)
+	}
+}
+
+type tailChunk struct {
+	header  piff.InHeader
+	payload []byte
+}
+
+func printFormat(format piff.DetectedFormat) {
+	if format.Format == piff.FileFormatHeaderless {
+		color.Yellow("-- headerless file, use piff-convert -from headerless to upgrade it\n")
+	}
+}
+
+// mergeRegistryChunk adds the types of reg1 chunks to the registry used to
+// print the chunks that follow.
+func mergeRegistryChunk(registry *piff.TypeRegistry, header piff.InHeader, payload []byte) error {
+	if !header.TypeID().IsEqual(piff.TypeRegistryTypeID) {
+		return nil
+	}
+	fileRegistry, registryErr := piff.NewTypeRegistryFromOctets(payload)
+	if registryErr != nil {
+		return registryErr
+	}
+	registry.Merge(fileRegistry)
+	return nil
+}
+
+// readTailScanning is used for files without a trailer.
+func readTailScanning(seeker *piff.InSeeker, count int) ([]tailChunk, error) {
+	chunkCount, countErr := seeker.CountChunks()
+	if countErr != nil {
+		return nil, countErr
+	}
+	first := chunkCount - count
+	if first < 0 {
+		first = 0
+	}
+	var chunks []tailChunk
+	for i := first; i < chunkCount; i++ {
+		header, payload, findErr := seeker.FindChunk(i)
+		if findErr != nil {
+			return nil, findErr
+		}
+		chunks = append(chunks, tailChunk{header: header, payload: payload})
+	}
+	return chunks, nil
+}
+
+func readTail(seekerToUse io.ReadSeeker, seeker *piff.InSeeker, format piff.FileFormat, count int) ([]tailChunk, error) {
+	if _, seekErr := seekerToUse.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, seekErr
+	}
+	iterator, iteratorErr := piff.NewReverseIteratorWithFormat(seekerToUse, format)
+	if errors.Is(iteratorErr, piff.ErrNoTrailer) {
+		return readTailScanning(seeker, count)
+	}
+	if iteratorErr != nil {
+		return nil, iteratorErr
+	}
+	chunks := make([]tailChunk, 0, count)
+	for len(chunks) < count {
+		header, payload, nextErr := iterator.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		chunks = append(chunks, tailChunk{header: header, payload: payload})
+	}
+	for i, j := 0, len(chunks)-1; i < j; i, j = i+1, j-1 {
+		chunks[i], chunks[j] = chunks[j], chunks[i]
+	}
+	return chunks, nil
+}
+
+// registryChunkCount is how many chunks at the start of the file are searched
+// for reg1 chunks in tail mode. The registry is written before the chunks it
+// describes, so the whole file is not scanned for it.
+const registryChunkCount = 8
+
+func readStartRegistry(seeker *piff.InSeeker, registry *piff.TypeRegistry) error {
+	for i := 0; i < registryChunkCount; i++ {
+		header, payload, findErr := seeker.FindChunk(i)
+		if errors.Is(findErr, piff.ErrIndexOutOfRange) {
+			return nil
+		}
+		if findErr != nil {
+			return findErr
+		}
+		if mergeErr := mergeRegistryChunk(registry, header, payload); mergeErr != nil {
+			return mergeErr
+		}
+	}
+	return nil
+}
+
+// runTail uses a lazy seeker, so only the start of the file is read for the
+// registry and the whole file is only scanned when it has no trailer.
+func runTail(seekerToUse io.ReadSeeker, format piff.FileFormat, count int) error {
+	seeker, seekerErr := piff.NewInSeekerWithOptions(seekerToUse, piff.InStreamOptions{Format: format, LazyIndex: true})
+	if seekerErr != nil {
+		return seekerErr
+	}
+	printFormat(seeker.Format())
+	registry := piff.NewStandardTypeRegistry()
+	if registryErr := readStartRegistry(seeker, registry); registryErr != nil {
+		return registryErr
+	}
+
+	chunks, tailErr := readTail(seekerToUse, seeker, seeker.Format().Format, count)
+	if tailErr != nil {
+		return tailErr
+	}
+	for _, chunk := range chunks {
+		if mergeErr := mergeRegistryChunk(registry, chunk.header, chunk.payload); mergeErr != nil {
+			return mergeErr
+		}
+		printChunk(registry, chunk.header, chunk.payload)
+	}
+	return nil
+}
+
+func run(o viewOptions, log *clog.Log) error {
+	seekerToUse, seekerErr := openReadSeeker(o.filename)
 	if seekerErr != nil {
 		return seekerErr
 	}
+	if o.tail > 0 {
+		return runTail(seekerToUse, o.format, o.tail)
+	}
 
-	inFile, err := piff.NewInStreamReadSeeker(seekerToUse)
+	inFile, err := piff.NewInStreamReadSeekerWithOptions(seekerToUse, piff.InStreamOptions{Format: o.format})
 	if err != nil {
 		return err
 	}
+	printFormat(inFile.Format())
 
+	printMetadata(inFile.Metadata())
+
+	registry := piff.NewStandardTypeRegistry()
 	for {
 		header, payload, readErr := inFile.ReadChunk()
 		if readErr == io.EOF {
 			break
 		}
-		fmt.Printf("-- %v: octetCount:%v index:%v\n", header.TypeIDString(), header.OctetCount(), header.ChunkIndex())
-		color.Cyan("%v\n", hex.Dump(payload))
-		base64String := base64.StdEncoding.EncodeToString(payload)
-		color.Blue("%v\n", base64String)
+		if readErr != nil {
+			return readErr
+		}
+		if mergeErr := mergeRegistryChunk(registry, header, payload); mergeErr != nil {
+			return mergeErr
+		}
+		printChunk(registry, header, payload)
 	}
 
 	return nil
@@ -97,8 +360,12 @@ func run(filename string, log *clog.Log) error {
 func main() {
 	log := clog.DefaultLog()
 	log.Info("Piff viewer")
-	filename := options()
-	err := run(filename, log)
+	o, optionsErr := options()
+	if optionsErr != nil {
+		log.Err(optionsErr)
+		os.Exit(1)
+	}
+	err := run(o, log)
 	if err != nil {
 		log.Err(err)
 		os.Exit(1)
@@ -0,0 +1,257 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+type OverflowPolicy uint8
+
+const (
+	OverflowBlock OverflowPolicy = iota
+	OverflowDropNewest
+	OverflowDropOldest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop newest"
+	case OverflowDropOldest:
+		return "drop oldest"
+	}
+	return fmt.Sprintf("overflow policy %d", p)
+}
+
+// AsyncOutStreamOptions.QueueChunkCount is how many chunks may wait to be
+// written, zero means 1024. Overflow decides what happens to a chunk that
+// does not fit in the queue.
+type AsyncOutStreamOptions struct {
+	QueueChunkCount int
+	Overflow        OverflowPolicy
+}
+
+const defaultQueueChunkCount = 1024
+
+type AsyncOutStreamStats struct {
+	WrittenCount uint64
+	DroppedCount uint64
+	QueuedCount  int
+}
+
+// AsyncOutStream writes chunks to an OutStream from a goroutine, so WriteChunk
+// only blocks when the queue is full and the overflow policy is OverflowBlock.
+// Queued chunks are written together with OutStream.WriteChunks. The
+// OutStream must not be used directly until the AsyncOutStream is closed.
+//
+// After a write error nothing more is written, since the stream may end in a
+// partial chunk. Chunks that were queued are dropped and counted.
+type AsyncOutStream struct {
+	outStream *OutStream
+	policy    OverflowPolicy
+	maxCount  int
+
+	mutex     sync.Mutex
+	changed   *sync.Cond
+	queue     []OutChunk
+	head      int
+	spare     []OutChunk
+	isWriting bool
+	isClosed  bool
+	writeErr  error
+	stats     AsyncOutStreamStats
+	done      chan struct{}
+}
+
+func NewAsyncOutStream(outStream *OutStream, options AsyncOutStreamOptions) *AsyncOutStream {
+	maxCount := options.QueueChunkCount
+	if maxCount <= 0 {
+		maxCount = defaultQueueChunkCount
+	}
+	c := &AsyncOutStream{
+		outStream: outStream,
+		policy:    options.Overflow,
+		maxCount:  maxCount,
+		queue:     make([]OutChunk, 0, 2*maxCount),
+		spare:     make([]OutChunk, 0, 2*maxCount),
+		done:      make(chan struct{}),
+	}
+	c.changed = sync.NewCond(&c.mutex)
+	go c.run()
+	return c
+}
+
+// queuedCount is the number of chunks in the queue. Dropping the oldest chunk
+// only moves head, the queue is compacted when it reaches its capacity of
+// twice the queue size.
+func (c *AsyncOutStream) queuedCount() int {
+	return len(c.queue) - c.head
+}
+
+func (c *AsyncOutStream) run() {
+	defer close(c.done)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for {
+		for c.queuedCount() == 0 && !c.isClosed {
+			c.changed.Wait()
+		}
+		if c.queuedCount() == 0 {
+			return
+		}
+		batch := c.queue
+		chunks := batch[c.head:]
+		c.queue = c.spare[:0]
+		c.head = 0
+		hasFailed := c.writeErr != nil
+		c.isWriting = true
+		c.changed.Broadcast()
+		c.mutex.Unlock()
+
+		var writtenCount int
+		var writeErr error
+		if !hasFailed {
+			chunkCount := c.outStream.chunkCount
+			writeErr = c.outStream.WriteChunks(chunks)
+			writtenCount = c.outStream.chunkCount - chunkCount
+		}
+
+		c.mutex.Lock()
+		c.isWriting = false
+		c.stats.WrittenCount += uint64(writtenCount)
+		c.stats.DroppedCount += uint64(len(chunks) - writtenCount)
+		if writeErr != nil && c.writeErr == nil {
+			c.writeErr = writeErr
+		}
+		for i := range batch {
+			batch[i] = OutChunk{}
+		}
+		c.spare = batch[:0]
+		c.changed.Broadcast()
+	}
+}
+
+func (c *AsyncOutStream) WriteChunkTypeIDString(typeID string, payload []byte) error {
+	fixedTypeID, typeIDErr := NewTypeIDFromString(typeID)
+	if typeIDErr != nil {
+		return typeIDErr
+	}
+	return c.WriteChunk(fixedTypeID, payload)
+}
+
+// WriteChunk queues a copy of the payload. Write errors are returned by Flush
+// and Close, and by WriteChunk once the goroutine has failed. Dropped chunks
+// are not errors, they are only counted.
+func (c *AsyncOutStream) WriteChunk(typeID TypeID, payload []byte) error {
+	if int64(len(payload)) > math.MaxUint32 {
+		return &ChunkError{Err: ErrInvalidOctetCount, TypeID: typeID, Message: fmt.Sprintf("payload of %d octets does not fit in a chunk", len(payload))}
+	}
+	chunk := OutChunk{TypeID: typeID, Payload: append([]byte{}, payload...)}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.policy == OverflowBlock && c.queuedCount() >= c.maxCount && !c.isClosed && c.writeErr == nil {
+		c.changed.Wait()
+	}
+	if c.isClosed {
+		return io.ErrClosedPipe
+	}
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	if c.queuedCount() >= c.maxCount {
+		c.stats.DroppedCount++
+		if c.policy == OverflowDropNewest {
+			return nil
+		}
+		c.queue[c.head] = OutChunk{}
+		c.head++
+	}
+	if len(c.queue) == cap(c.queue) {
+		queuedCount := copy(c.queue, c.queue[c.head:])
+		for i := queuedCount; i < len(c.queue); i++ {
+			c.queue[i] = OutChunk{}
+		}
+		c.queue = c.queue[:queuedCount]
+		c.head = 0
+	}
+	c.queue = append(c.queue, chunk)
+	c.changed.Broadcast()
+	return nil
+}
+
+func (c *AsyncOutStream) flush() error {
+	for c.queuedCount() > 0 || c.isWriting {
+		c.changed.Wait()
+	}
+	return c.writeErr
+}
+
+// Flush waits until every queued chunk is written and returns the first
+// write error, if any.
+func (c *AsyncOutStream) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.flush()
+}
+
+// Close writes the queued chunks, stops the goroutine and closes the
+// OutStream. It returns the first write error, if any.
+func (c *AsyncOutStream) Close() error {
+	c.mutex.Lock()
+	if c.isClosed {
+		writeErr := c.writeErr
+		c.mutex.Unlock()
+		<-c.done
+		return writeErr
+	}
+	flushErr := c.flush()
+	c.isClosed = true
+	c.changed.Broadcast()
+	c.mutex.Unlock()
+	<-c.done
+
+	closeErr := c.outStream.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+func (c *AsyncOutStream) Stats() AsyncOutStreamStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.QueuedCount = c.queuedCount()
+	return stats
+}
@@ -0,0 +1,255 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter blocks every Write until release is closed, once block has
+// been called. entered is signalled when a Write starts.
+type gatedWriter struct {
+	bytes.Buffer
+	entered chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (w *gatedWriter) block() {
+	w.entered = make(chan struct{}, 1)
+	w.release = make(chan struct{})
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	if w.release != nil {
+		select {
+		case w.entered <- struct{}{}:
+		default:
+		}
+		<-w.release
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+func newGatedAsyncOutStream(t *testing.T, options AsyncOutStreamOptions) (*AsyncOutStream, *gatedWriter) {
+	writer := &gatedWriter{}
+	outStream, outErr := NewOutStreamWriter(writer)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	writer.block()
+	return NewAsyncOutStream(outStream, options), writer
+}
+
+func writtenPayloads(t *testing.T, octets []byte) []string {
+	inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(octets))
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	var payloads []string
+	for !inStream.IsEOF() {
+		_, payload, readErr := inStream.ReadChunk()
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		payloads = append(payloads, string(payload))
+	}
+	return payloads
+}
+
+// writeWhileBlocked writes chunk 0, waits until it is being written, and then
+// writes chunk 1 to 4 into a queue of two.
+func writeWhileBlocked(t *testing.T, policy OverflowPolicy) ([]string, AsyncOutStreamStats) {
+	async, writer := newGatedAsyncOutStream(t, AsyncOutStreamOptions{QueueChunkCount: 2, Overflow: policy})
+	async.WriteChunkTypeIDString("cafe", []byte("0"))
+	<-writer.entered
+	payload := []byte("x")
+	for i := 1; i < 5; i++ {
+		payload[0] = byte('0' + i)
+		if writeErr := async.WriteChunkTypeIDString("cafe", payload); writeErr != nil {
+			t.Fatal(writeErr)
+		}
+	}
+	stats := async.Stats()
+	close(writer.release)
+	if closeErr := async.Close(); closeErr != nil {
+		t.Fatal(closeErr)
+	}
+	return writtenPayloads(t, writer.Bytes()), stats
+}
+
+func TestAsyncOutStreamDrop(t *testing.T) {
+	expected := map[OverflowPolicy]string{
+		OverflowDropNewest: "[0 1 2]",
+		OverflowDropOldest: "[0 3 4]",
+	}
+	for policy, expectedPayloads := range expected {
+		payloads, stats := writeWhileBlocked(t, policy)
+		if fmt.Sprint(payloads) != expectedPayloads {
+			t.Errorf("%v: expected %v, got %v", policy, expectedPayloads, payloads)
+		}
+		if stats.DroppedCount != 2 || stats.QueuedCount != 2 {
+			t.Errorf("%v: wrong stats %+v", policy, stats)
+		}
+	}
+}
+
+func TestAsyncOutStreamBlock(t *testing.T) {
+	async, writer := newGatedAsyncOutStream(t, AsyncOutStreamOptions{QueueChunkCount: 2})
+	async.WriteChunkTypeIDString("cafe", []byte("0"))
+	<-writer.entered
+	async.WriteChunkTypeIDString("cafe", []byte("1"))
+	async.WriteChunkTypeIDString("cafe", []byte("2"))
+	written := make(chan struct{})
+	go func() {
+		async.WriteChunkTypeIDString("cafe", []byte("3"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatalf("write should block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(writer.release)
+	<-written
+	if flushErr := async.Flush(); flushErr != nil {
+		t.Fatal(flushErr)
+	}
+	stats := async.Stats()
+	if stats.WrittenCount != 4 || stats.DroppedCount != 0 || stats.QueuedCount != 0 {
+		t.Errorf("wrong stats %+v", stats)
+	}
+	async.Close()
+	if payloads := writtenPayloads(t, writer.Bytes()); fmt.Sprint(payloads) != "[0 1 2 3]" {
+		t.Errorf("wrong payloads %v", payloads)
+	}
+	if writeErr := async.WriteChunkTypeIDString("cafe", nil); writeErr != io.ErrClosedPipe {
+		t.Errorf("expected closed, got %v", writeErr)
+	}
+}
+
+func TestAsyncOutStreamError(t *testing.T) {
+	diskFull := errors.New("disk full")
+	writer := &gatedWriter{}
+	outStream, _ := NewOutStreamWriter(writer)
+	writer.err = diskFull
+	async := NewAsyncOutStream(outStream, AsyncOutStreamOptions{})
+	async.WriteChunkTypeIDString("cafe", nil)
+	if flushErr := async.Flush(); !errors.Is(flushErr, diskFull) {
+		t.Errorf("expected the write error, got %v", flushErr)
+	}
+	writer.err = nil
+	async.WriteChunkTypeIDString("cafe", nil)
+	if closeErr := async.Close(); !errors.Is(closeErr, diskFull) {
+		t.Errorf("close should return the first write error, got %v", closeErr)
+	}
+	if closeErr := async.Close(); !errors.Is(closeErr, diskFull) {
+		t.Errorf("closing again should return the same error, got %v", closeErr)
+	}
+}
+
+func TestAsyncOutStreamConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriterWithOptions(&buf, OutStreamOptions{Trailer: true})
+	async := NewAsyncOutStream(outStream, AsyncOutStreamOptions{QueueChunkCount: 8})
+	var wait sync.WaitGroup
+	for writerIndex := 0; writerIndex < 4; writerIndex++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := 0; i < 250; i++ {
+				async.WriteChunkTypeIDString("cafe", []byte("some payload"))
+			}
+		}()
+	}
+	wait.Wait()
+	if closeErr := async.Close(); closeErr != nil {
+		t.Fatal(closeErr)
+	}
+	iterator, iteratorErr := NewReverseIterator(bytes.NewReader(buf.Bytes()))
+	if iteratorErr != nil {
+		t.Fatal(iteratorErr)
+	}
+	if iterator.ChunkCount() != 1000 {
+		t.Errorf("expected 1000 chunks, got %d", iterator.ChunkCount())
+	}
+}
+
+func TestAsyncOutStreamShortWrite(t *testing.T) {
+	fileHeaderSize := len(fileFormatHeaderWithVersion(FileFormatVersion))
+	writer := &failingWriter{octetCount: fileHeaderSize + chunkHeaderOctetCount + len("first") + 10}
+	outStream, outErr := NewOutStreamWriter(writer)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	async := NewAsyncOutStream(outStream, AsyncOutStreamOptions{})
+	async.WriteChunkTypeIDString("cafe", []byte("first"))
+	async.WriteChunkTypeIDString("cafe", []byte("second"))
+	flushErr := async.Flush()
+	expectChunkError(t, flushErr, io.ErrShortWrite, 1, int64(fileHeaderSize+chunkHeaderOctetCount+len("first")))
+	if writeErr := async.WriteChunkTypeIDString("cafe", []byte("third")); writeErr != flushErr {
+		t.Errorf("writes after a failure should return it, got %v", writeErr)
+	}
+	if stats := async.Stats(); stats.WrittenCount != 1 || stats.DroppedCount != 1 {
+		t.Errorf("wrong stats %+v", stats)
+	}
+	async.Close()
+
+	_, validateErr := Validate(bytes.NewReader(writer.Bytes()))
+	var validationErr *ValidationError
+	if !errors.As(validateErr, &validationErr) || validationErr.Kind != ValidationTruncatedChunk || validationErr.Offset != int64(fileHeaderSize+chunkHeaderOctetCount+len("first")) {
+		t.Errorf("only the last chunk should be partial, got %v", validateErr)
+	}
+}
+
+func TestAsyncOutStreamDropOldestMany(t *testing.T) {
+	async, writer := newGatedAsyncOutStream(t, AsyncOutStreamOptions{QueueChunkCount: 3, Overflow: OverflowDropOldest})
+	async.WriteChunkTypeIDString("cafe", []byte("0"))
+	<-writer.entered
+	for i := 1; i < 20; i++ {
+		async.WriteChunkTypeIDString("cafe", []byte(fmt.Sprint(i)))
+	}
+	if stats := async.Stats(); stats.DroppedCount != 16 || stats.QueuedCount != 3 {
+		t.Errorf("wrong stats %+v", stats)
+	}
+	close(writer.release)
+	if closeErr := async.Close(); closeErr != nil {
+		t.Fatal(closeErr)
+	}
+	if payloads := writtenPayloads(t, writer.Bytes()); fmt.Sprint(payloads) != "[0 17 18 19]" {
+		t.Errorf("wrong payloads %v", payloads)
+	}
+}
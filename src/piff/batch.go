@@ -0,0 +1,125 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+)
+
+type OutChunk struct {
+	TypeID  TypeID
+	Payload []byte
+}
+
+// Payloads smaller than this are copied next to their chunk header, larger
+// ones are handed to the vectored write as they are.
+const coalescePayloadOctetCount = 1024
+
+// WriteChunks writes all chunks with as few write calls as possible. Files are
+// only synced once, after the whole batch. If a write fails, the chunks that
+// were written completely are still counted, like earlier WriteChunk calls.
+func (c *OutStream) WriteChunks(chunks []OutChunk) error {
+	coalescedOctetCount := 0
+	for i, chunk := range chunks {
+		if int64(len(chunk.Payload)) > math.MaxUint32 {
+			chunkErr := c.newChunkError(ErrInvalidOctetCount, chunk.TypeID, "payload of %d octets does not fit in a chunk", len(chunk.Payload))
+			chunkErr.ChunkIndex += ChunkIndex(i)
+			return chunkErr
+		}
+		coalescedOctetCount += chunkHeaderOctetCount
+		if len(chunk.Payload) < coalescePayloadOctetCount {
+			coalescedOctetCount += len(chunk.Payload)
+		}
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	if cap(c.coalesced) < coalescedOctetCount {
+		c.coalesced = make([]byte, 0, coalescedOctetCount)
+	}
+	// coalesced never grows past its capacity, so the buffers can point into it.
+	coalesced := c.coalesced[:0]
+	var buffers net.Buffers
+	start := 0
+	for _, chunk := range chunks {
+		coalesced = append(coalesced, chunk.TypeID[0:]...)
+		var octetCount [4]byte
+		binary.BigEndian.PutUint32(octetCount[:], uint32(len(chunk.Payload)))
+		coalesced = append(coalesced, octetCount[:]...)
+		if len(chunk.Payload) < coalescePayloadOctetCount {
+			coalesced = append(coalesced, chunk.Payload...)
+			continue
+		}
+		buffers = append(buffers, coalesced[start:], chunk.Payload)
+		start = len(coalesced)
+	}
+	if start < len(coalesced) {
+		buffers = append(buffers, coalesced[start:])
+	}
+
+	var writtenOctetCount int64
+	var writeErr error
+	if c.vectorFile != nil {
+		writtenOctetCount, writeErr = writeVectored(c.vectorFile, buffers)
+	} else {
+		writtenOctetCount, writeErr = buffers.WriteTo(c.writer)
+	}
+	writtenCount := c.addWrittenChunks(chunks, writtenOctetCount)
+	if writeErr != nil {
+		var typeID TypeID
+		if writtenCount < len(chunks) {
+			typeID = chunks[writtenCount].TypeID
+		}
+		return c.newChunkError(writeErr, typeID, "")
+	}
+
+	if c.file != nil {
+		c.file.Sync()
+	}
+	return nil
+}
+
+// addWrittenChunks counts the chunks that fit completely in the written octets
+// and returns how many they are.
+func (c *OutStream) addWrittenChunks(chunks []OutChunk, writtenOctetCount int64) int {
+	for i, chunk := range chunks {
+		chunkOctetCount := chunkHeaderOctetCount + int64(len(chunk.Payload))
+		if chunkOctetCount > writtenOctetCount {
+			return i
+		}
+		writtenOctetCount -= chunkOctetCount
+		c.chunkCount++
+		c.octetCount += chunkOctetCount
+		if c.hasTrailer {
+			c.octetCounts = append(c.octetCounts, uint32(len(chunk.Payload)))
+		}
+	}
+	return len(chunks)
+}
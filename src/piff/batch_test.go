@@ -0,0 +1,205 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testOutChunks(t *testing.T, chunkCount int) []OutChunk {
+	chunks := make([]OutChunk, chunkCount)
+	for i := range chunks {
+		octetCount := i % 7
+		if i%5 == 3 {
+			octetCount = coalescePayloadOctetCount + i
+		}
+		chunks[i] = newTestChunk(t, fmt.Sprintf("c%03d", i%1000), bytes.Repeat([]byte{byte(i)}, octetCount))
+	}
+	return chunks
+}
+
+func TestWriteChunks(t *testing.T) {
+	chunks := testOutChunks(t, 3000)
+	options := OutStreamOptions{Trailer: true}
+	expected := writeTestFile(t, options, chunks)
+
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriterWithOptions(&buf, options)
+	outStream.WriteChunks(chunks[:10])
+	outStream.WriteChunks(nil)
+	outStream.WriteChunks(chunks[10:])
+	outStream.Close()
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("batched writes to a writer differ")
+	}
+
+	newFile, createErr := ioutil.TempFile("", "batch")
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer os.Remove(newFile.Name())
+	fileStream, _ := NewOutStreamFileWithOptions(newFile, options)
+	if writeErr := fileStream.WriteChunks(chunks); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	if closeErr := fileStream.Close(); closeErr != nil {
+		t.Fatal(closeErr)
+	}
+	written, readErr := ioutil.ReadFile(newFile.Name())
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if !bytes.Equal(written, expected) {
+		t.Errorf("batched writes to a file differ")
+	}
+}
+
+func TestWriteChunksErrors(t *testing.T) {
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	headerOctetCount := buf.Len()
+	if writeErr := outStream.WriteChunks([]OutChunk{{TypeID: MetadataTypeID}}); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	if outStream.chunkCount != 1 || buf.Len() != headerOctetCount+chunkHeaderOctetCount {
+		t.Errorf("wrong chunk count %d or octet count %d", outStream.chunkCount, buf.Len())
+	}
+
+	closedFile, createErr := ioutil.TempFile("", "closed")
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer os.Remove(closedFile.Name())
+	fileStream, _ := NewOutStreamFile(closedFile)
+	closedFile.Close()
+	if writeErr := fileStream.WriteChunks(testOutChunks(t, 3)); writeErr == nil {
+		t.Errorf("writing to a closed file should fail")
+	}
+	if fileStream.chunkCount != 0 {
+		t.Errorf("failed writes should not be counted")
+	}
+}
+
+// failingWriter keeps the first octetCount octets and then fails.
+type failingWriter struct {
+	bytes.Buffer
+	octetCount int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.octetCount {
+		written, _ := w.Buffer.Write(p[:w.octetCount])
+		w.octetCount = 0
+		return written, io.ErrShortWrite
+	}
+	w.octetCount -= len(p)
+	return w.Buffer.Write(p)
+}
+
+func TestWriteChunksPartialFailure(t *testing.T) {
+	chunks := []OutChunk{
+		{TypeID: TimestampTypeID, Payload: []byte("first")},
+		{TypeID: TimestampTypeID, Payload: bytes.Repeat([]byte{1}, coalescePayloadOctetCount)},
+		{TypeID: TimestampTypeID, Payload: []byte("third")},
+	}
+	fileHeaderSize := len(fileFormatHeaderWithVersion(FileFormatVersion))
+	writer := &failingWriter{octetCount: fileHeaderSize + 2*chunkHeaderOctetCount + len("first") + 10}
+	outStream, _ := NewOutStreamWriterWithOptions(writer, OutStreamOptions{Trailer: true})
+	if writeErr := outStream.WriteChunks(chunks); writeErr == nil {
+		t.Fatal("expected the write to fail")
+	}
+	if outStream.chunkCount != 1 || len(outStream.octetCounts) != 1 || outStream.octetCounts[0] != uint32(len("first")) {
+		t.Errorf("only the first chunk was written completely, got %d %v", outStream.chunkCount, outStream.octetCounts)
+	}
+	if outStream.octetCount != int64(fileHeaderSize+chunkHeaderOctetCount+len("first")) {
+		t.Errorf("wrong octet count %d", outStream.octetCount)
+	}
+}
+
+// benchmarkPipe drains the read end of a pipe. The write end is given to
+// NewOutStreamWriter, so WriteChunks uses writev and neither WriteChunk nor
+// WriteChunks syncs.
+func benchmarkPipe(b *testing.B) (*os.File, func()) {
+	reader, writer, pipeErr := os.Pipe()
+	if pipeErr != nil {
+		b.Fatal(pipeErr)
+	}
+	drained := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, reader)
+		reader.Close()
+		close(drained)
+	}()
+	return writer, func() {
+		writer.Close()
+		<-drained
+	}
+}
+
+// BenchmarkWriteChunks writes batches of 1000 chunks to a pipe, so it compares
+// the number of write calls and not how often a file is synced.
+func BenchmarkWriteChunks(b *testing.B) {
+	for _, octetCount := range []int{16, 4096} {
+		chunks := make([]OutChunk, 1000)
+		batchOctetCount := 0
+		for i := range chunks {
+			chunks[i] = OutChunk{TypeID: TimestampTypeID, Payload: make([]byte, octetCount)}
+			batchOctetCount += chunkHeaderOctetCount + octetCount
+		}
+		b.Run(fmt.Sprintf("WriteChunk/%d", octetCount), func(b *testing.B) {
+			writer, closePipe := benchmarkPipe(b)
+			defer closePipe()
+			outStream, _ := NewOutStreamWriter(writer)
+			b.SetBytes(int64(batchOctetCount))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for _, chunk := range chunks {
+					if writeErr := outStream.WriteChunk(chunk.TypeID, chunk.Payload); writeErr != nil {
+						b.Fatal(writeErr)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("WriteChunks/%d", octetCount), func(b *testing.B) {
+			writer, closePipe := benchmarkPipe(b)
+			defer closePipe()
+			outStream, _ := NewOutStreamWriter(writer)
+			b.SetBytes(int64(batchOctetCount))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if writeErr := outStream.WriteChunks(chunks); writeErr != nil {
+					b.Fatal(writeErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// A capture is a timestamped piff stream where every successful Read is a
+// 'recv' chunk and every successful Write is a 'send' chunk.
+var CaptureReceiveTypeID = TypeID{'r', 'e', 'c', 'v'}
+var CaptureSendTypeID = TypeID{'s', 'e', 'n', 'd'}
+
+type Recorder struct {
+	readWriter io.ReadWriter
+	outStream  *OutStream
+	start      time.Time
+	mutex      sync.Mutex
+}
+
+func NewRecorder(readWriter io.ReadWriter, outStream *OutStream) *Recorder {
+	return &Recorder{
+		readWriter: readWriter,
+		outStream:  outStream,
+		start:      time.Now(),
+	}
+}
+
+func (r *Recorder) record(typeID TypeID, payload []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.outStream.WriteTimestampedChunk(time.Since(r.start), typeID, payload)
+}
+
+// Read returns the recording error if the read itself succeeded but could
+// not be recorded.
+func (r *Recorder) Read(p []byte) (int, error) {
+	octetCount, readErr := r.readWriter.Read(p)
+	if octetCount > 0 {
+		if recordErr := r.record(CaptureReceiveTypeID, p[:octetCount]); recordErr != nil && readErr == nil {
+			readErr = recordErr
+		}
+	}
+	return octetCount, readErr
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	octetCount, writeErr := r.readWriter.Write(p)
+	if octetCount > 0 {
+		if recordErr := r.record(CaptureSendTypeID, p[:octetCount]); recordErr != nil && writeErr == nil {
+			writeErr = recordErr
+		}
+	}
+	return octetCount, writeErr
+}
+
+type RecordingConn struct {
+	net.Conn
+	recorder *Recorder
+}
+
+func NewRecordingConn(conn net.Conn, outStream *OutStream) *RecordingConn {
+	return &RecordingConn{Conn: conn, recorder: NewRecorder(conn, outStream)}
+}
+
+func (c *RecordingConn) Read(p []byte) (int, error) {
+	return c.recorder.Read(p)
+}
+
+func (c *RecordingConn) Write(p []byte) (int, error) {
+	return c.recorder.Write(p)
+}
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string {
+	return "piff"
+}
+
+func (replayAddr) String() string {
+	return "replay"
+}
+
+type replayChunk struct {
+	isSend  bool
+	payload []byte
+}
+
+// ReplayConn plays back a capture in the recorded order. Reads return the
+// received data with the original chunk boundaries, and block until the data
+// sent before it has been written. Writes must match the sent data, in any
+// split, and may not skip received data that has not been read, or they fail.
+type ReplayConn struct {
+	mutex    sync.Mutex
+	changed  *sync.Cond
+	chunks   []replayChunk
+	index    int
+	offset   int
+	isClosed bool
+}
+
+func NewReplayConn(inStream *InStream) (*ReplayConn, error) {
+	c := &ReplayConn{}
+	c.changed = sync.NewCond(&c.mutex)
+	for {
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		isSend := header.TypeID().IsEqual(CaptureSendTypeID)
+		if (isSend || header.TypeID().IsEqual(CaptureReceiveTypeID)) && len(payload) > 0 {
+			c.chunks = append(c.chunks, replayChunk{isSend: isSend, payload: payload})
+		}
+	}
+	return c, nil
+}
+
+// consume moves past octetCount octets of the current chunk.
+func (c *ReplayConn) consume(octetCount int) {
+	c.offset += octetCount
+	if c.offset == len(c.chunks[c.index].payload) {
+		c.index++
+		c.offset = 0
+	}
+	c.changed.Broadcast()
+}
+
+func (c *ReplayConn) Read(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for !c.isClosed && c.index < len(c.chunks) && c.chunks[c.index].isSend {
+		c.changed.Wait()
+	}
+	if c.isClosed {
+		return 0, io.ErrClosedPipe
+	}
+	if c.index >= len(c.chunks) {
+		return 0, io.EOF
+	}
+	octetCount := copy(p, c.chunks[c.index].payload[c.offset:])
+	c.consume(octetCount)
+	return octetCount, nil
+}
+
+func (c *ReplayConn) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isClosed {
+		return 0, io.ErrClosedPipe
+	}
+	index, offset := c.index, c.offset
+	for i := 0; i < len(p); {
+		if index >= len(c.chunks) {
+			return 0, fmt.Errorf("piff: replay: write of %d octets goes past the end of the capture", len(p))
+		}
+		chunk := c.chunks[index]
+		if !chunk.isSend {
+			return 0, fmt.Errorf("piff: replay: write of %d octets, but the capture expects %d received octets to be read first", len(p), len(chunk.payload)-offset)
+		}
+		expected := chunk.payload[offset:]
+		if len(expected) > len(p)-i {
+			expected = expected[:len(p)-i]
+		}
+		if !bytes.Equal(p[i:i+len(expected)], expected) {
+			return 0, fmt.Errorf("piff: replay: write differs from the sent data in chunk %d", index)
+		}
+		i += len(expected)
+		offset += len(expected)
+		if offset == len(chunk.payload) {
+			index++
+			offset = 0
+		}
+	}
+	for written := 0; written < len(p); {
+		octetCount := len(c.chunks[c.index].payload) - c.offset
+		if octetCount > len(p)-written {
+			octetCount = len(p) - written
+		}
+		c.consume(octetCount)
+		written += octetCount
+	}
+	return len(p), nil
+}
+
+// IsDone tells if everything received has been read and everything sent has
+// been written.
+func (c *ReplayConn) IsDone() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.index >= len(c.chunks)
+}
+
+func (c *ReplayConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.isClosed = true
+	c.changed.Broadcast()
+	return nil
+}
+
+func (c *ReplayConn) LocalAddr() net.Addr {
+	return replayAddr{}
+}
+
+func (c *ReplayConn) RemoteAddr() net.Addr {
+	return replayAddr{}
+}
+
+func (c *ReplayConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *ReplayConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *ReplayConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
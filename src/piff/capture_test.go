@@ -0,0 +1,208 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveUpperCase(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil {
+			return
+		}
+		conn.Write([]byte(strings.ToUpper(line)))
+	}
+}
+
+func talkUpperCase(t *testing.T, conn net.Conn) []string {
+	reader := bufio.NewReader(conn)
+	var replies []string
+	for _, line := range []string{"hello\n", "piff capture\n"} {
+		if _, writeErr := conn.Write([]byte(line)); writeErr != nil {
+			t.Fatal(writeErr)
+		}
+		reply, readErr := reader.ReadString('\n')
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func recordAndReplay(t *testing.T, client net.Conn) {
+	var capture bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&capture)
+	recordingConn := NewRecordingConn(client, outStream)
+	replies := talkUpperCase(t, recordingConn)
+	recordingConn.Close()
+	if replies[1] != "PIFF CAPTURE\n" {
+		t.Fatalf("wrong live reply %v", replies)
+	}
+
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(capture.Bytes()))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	sendCount, _ := seeker.Count(CaptureSendTypeID)
+	if hasTimestamps, _ := seeker.HasTimestamps(); sendCount != 2 || !hasTimestamps {
+		t.Errorf("expected two timestamped send chunks, got %v", sendCount)
+	}
+
+	inStream, _ := NewInStreamReadSeeker(bytes.NewReader(capture.Bytes()))
+	replayConn, replayErr := NewReplayConn(inStream)
+	if replayErr != nil {
+		t.Fatal(replayErr)
+	}
+	replayedReplies := talkUpperCase(t, replayConn)
+	if strings.Join(replayedReplies, "") != strings.Join(replies, "") {
+		t.Errorf("replay differs %v %v", replayedReplies, replies)
+	}
+	if !replayConn.IsDone() {
+		t.Errorf("replay should be done")
+	}
+	if _, writeErr := replayConn.Write([]byte("more")); writeErr == nil {
+		t.Errorf("writing more than was captured should fail")
+	}
+}
+
+func TestCapturePipe(t *testing.T) {
+	client, server := net.Pipe()
+	go serveUpperCase(server)
+	recordAndReplay(t, client)
+}
+
+func TestCaptureLoopback(t *testing.T) {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Skip(listenErr)
+	}
+	defer listener.Close()
+	go func() {
+		server, acceptErr := listener.Accept()
+		if acceptErr == nil {
+			serveUpperCase(server)
+		}
+	}()
+	client, dialErr := net.Dial("tcp", listener.Addr().String())
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+	recordAndReplay(t, client)
+}
+
+func TestReplayMismatch(t *testing.T) {
+	var capture bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&capture)
+	outStream.WriteChunk(CaptureSendTypeID, []byte("hello"))
+
+	inStream, _ := NewInStreamReadSeeker(bytes.NewReader(capture.Bytes()))
+	replayConn, _ := NewReplayConn(inStream)
+	if _, writeErr := replayConn.Write([]byte("he")); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	if _, writeErr := replayConn.Write([]byte("LLO")); writeErr == nil {
+		t.Errorf("expected mismatch")
+	}
+}
+
+func newReplayTestConn(t *testing.T, chunks ...OutChunk) *ReplayConn {
+	var capture bytes.Buffer
+	outStream, outErr := NewOutStreamWriter(&capture)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	if writeErr := outStream.WriteChunks(chunks); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(capture.Bytes()))
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	replayConn, replayErr := NewReplayConn(inStream)
+	if replayErr != nil {
+		t.Fatal(replayErr)
+	}
+	return replayConn
+}
+
+func TestReplayOrder(t *testing.T) {
+	replayConn := newReplayTestConn(t,
+		OutChunk{TypeID: CaptureSendTypeID, Payload: []byte("hello")},
+		OutChunk{TypeID: CaptureReceiveTypeID, Payload: []byte("HELLO")},
+		OutChunk{TypeID: CaptureSendTypeID, Payload: []byte("bye")},
+	)
+	replied := make(chan string)
+	go func() {
+		reply := make([]byte, 10)
+		octetCount, _ := replayConn.Read(reply)
+		replied <- string(reply[:octetCount])
+	}()
+	select {
+	case <-replied:
+		t.Fatalf("read should block until the request has been written")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if _, writeErr := replayConn.Write([]byte("hellobye")); writeErr == nil {
+		t.Errorf("writing past the unread reply should fail")
+	}
+	if _, writeErr := replayConn.Write([]byte("hello")); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	if reply := <-replied; reply != "HELLO" {
+		t.Errorf("wrong reply %q", reply)
+	}
+	if _, writeErr := replayConn.Write([]byte("bye")); writeErr != nil || !replayConn.IsDone() {
+		t.Errorf("replay should be done, got %v", writeErr)
+	}
+}
+
+func TestReplayCloseUnblocksRead(t *testing.T) {
+	replayConn := newReplayTestConn(t,
+		OutChunk{TypeID: CaptureSendTypeID, Payload: []byte("hello")},
+		OutChunk{TypeID: CaptureReceiveTypeID, Payload: []byte("HELLO")},
+	)
+	readDone := make(chan error)
+	go func() {
+		_, readErr := replayConn.Read(make([]byte, 10))
+		readDone <- readErr
+	}()
+	replayConn.Close()
+	if readErr := <-readDone; readErr != io.ErrClosedPipe {
+		t.Errorf("expected closed, got %v", readErr)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBadMagic           = errors.New("piff: bad file header")
+	ErrUnsupportedVersion = errors.New("piff: unsupported version")
+	ErrUnknownFormat      = errors.New("piff: unknown file format")
+	ErrTruncated          = errors.New("piff: truncated")
+	ErrTrailingGarbage    = errors.New("piff: trailing garbage")
+	ErrIndexOutOfRange    = errors.New("piff: chunk index out of range")
+	ErrNotFound           = errors.New("piff: chunk not found")
+	ErrNoTimestamps       = errors.New("piff: no timestamps")
+	ErrTimestampOrder     = errors.New("piff: timestamp out of order")
+	ErrInvalidTimestamp   = errors.New("piff: invalid timestamp")
+	ErrInvalidTypeID      = errors.New("piff: invalid type id")
+	ErrInvalidOctetCount  = errors.New("piff: invalid octet count")
+	ErrLimitExceeded      = errors.New("piff: limit exceeded")
+	ErrMetadataNotFirst   = errors.New("piff: metadata is not the first chunk")
+	ErrInvalidMetadata    = errors.New("piff: invalid metadata")
+	ErrInvalidRegistry    = errors.New("piff: invalid type registry")
+	ErrNoTrailer          = errors.New("piff: no trailer")
+	ErrBadTrailer         = errors.New("piff: bad trailer")
+)
+
+// ChunkError tells where in the file something went wrong. Err is, or wraps,
+// one of the sentinel errors above, so it can be checked with errors.Is. Offset is the
+// octet offset of the chunk header, or of the file header for file level
+// errors.
+type ChunkError struct {
+	Err        error
+	ChunkIndex ChunkIndex
+	Offset     int64
+	TypeID     TypeID
+	Message    string
+}
+
+func newChunkError(err error, header InHeader, format string, args ...interface{}) *ChunkError {
+	return &ChunkError{Err: err, ChunkIndex: header.chunkIndex, Offset: header.tell, TypeID: header.typeID, Message: fmt.Sprintf(format, args...)}
+}
+
+// wrapChunkError adds the position of the chunk to an error that already
+// describes the problem.
+func wrapChunkError(err error, header InHeader) *ChunkError {
+	return &ChunkError{Err: err, ChunkIndex: header.chunkIndex, Offset: header.tell, TypeID: header.typeID}
+}
+
+func (e *ChunkError) Error() string {
+	location := fmt.Sprintf("offset %d (chunk %d)", e.Offset, e.ChunkIndex)
+	if e.TypeID != (TypeID{}) {
+		location = fmt.Sprintf("offset %d (chunk %d '%v')", e.Offset, e.ChunkIndex, e.TypeID)
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("%v at %v", e.Err, location)
+	}
+	return fmt.Sprintf("%v at %v: %v", e.Err, location, e.Message)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
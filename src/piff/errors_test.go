@@ -0,0 +1,154 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func expectChunkError(t *testing.T, err error, sentinel error, chunkIndex ChunkIndex, offset int64) {
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("expected %v, got %v", sentinel, err)
+	}
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected a ChunkError, got %v", err)
+	}
+	if chunkErr.ChunkIndex != chunkIndex || chunkErr.Offset != offset {
+		t.Errorf("expected chunk %d at %d, got %v", chunkIndex, offset, chunkErr)
+	}
+}
+
+func TestErrorsInStream(t *testing.T) {
+	octets := writeTestChunks(t, 2)
+	fileHeaderSize := int64(len(fileFormatHeaderWithVersion(FileFormatVersion)))
+	chunkSize := int64(chunkHeaderOctetCount + len("some payload"))
+
+	badMagic := append([]byte{}, octets...)
+	badMagic[1] = 'X'
+	_, magicErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(badMagic), InStreamOptions{Format: FileFormatPiff})
+	expectChunkError(t, magicErr, ErrBadMagic, 0, 0)
+
+	badVersion := append([]byte{}, octets...)
+	badVersion[9] = FileFormatVersion + 1
+	_, versionErr := NewInStreamReadSeeker(bytes.NewReader(badVersion))
+	expectChunkError(t, versionErr, ErrUnsupportedVersion, 0, 0)
+
+	inStream, _ := NewInStreamReadSeeker(bytes.NewReader(octets[:len(octets)-2]))
+	if _, _, firstErr := inStream.ReadChunk(); firstErr != nil {
+		t.Fatal(firstErr)
+	}
+	_, _, truncatedErr := inStream.ReadChunk()
+	expectChunkError(t, truncatedErr, ErrTruncated, 1, fileHeaderSize+chunkSize)
+	var chunkErr *ChunkError
+	if errors.As(truncatedErr, &chunkErr) && !chunkErr.TypeID.IsEqualString("cafe") {
+		t.Errorf("wrong type id %v", chunkErr.TypeID)
+	}
+
+	for _, readAheadChunkCount := range []int{0, 2} {
+		inStream, _ = NewInStreamReadSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{ReadAheadChunkCount: readAheadChunkCount})
+		_, _, partErr := inStream.ReadPartChunk(100)
+		expectChunkError(t, partErr, ErrInvalidOctetCount, 0, fileHeaderSize)
+		_, _, negativeErr := inStream.ReadPartChunk(-1)
+		expectChunkError(t, negativeErr, ErrInvalidOctetCount, 0, fileHeaderSize)
+		inStream.Close()
+	}
+
+	_, limitErr := readAllChunks(octets, InStreamOptions{MaxChunkCount: 1})
+	if !errors.Is(limitErr, ErrLimitExceeded) {
+		t.Errorf("expected limit error, got %v", limitErr)
+	}
+}
+
+func TestErrorsInSeekerAndOutStream(t *testing.T) {
+	fileHeaderSize := int64(len(fileFormatHeaderWithVersion(FileFormatVersion)))
+	chunkSize := int64(chunkHeaderOctetCount + len("some payload"))
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(writeTestChunks(t, 2)))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	_, _, findErr := seeker.FindChunk(100)
+	expectChunkError(t, findErr, ErrIndexOutOfRange, 100, fileHeaderSize+2*chunkSize)
+	_, _, firstErr := seeker.FindFirst(MetadataTypeID)
+	expectChunkError(t, firstErr, ErrNotFound, 0, fileHeaderSize+2*chunkSize)
+	cafe, _ := NewTypeIDFromString("cafe")
+	_, _, nthErr := seeker.FindNth(cafe, 2)
+	expectChunkError(t, nthErr, ErrNotFound, 0, fileHeaderSize+2*chunkSize)
+	_, _, partialErr := seeker.FindPartialChunk(1, len("some payload")+1)
+	expectChunkError(t, partialErr, ErrInvalidOctetCount, 1, fileHeaderSize+chunkSize)
+	_, _, negativeErr := seeker.FindPartialChunk(0, -1)
+	expectChunkError(t, negativeErr, ErrInvalidOctetCount, 0, fileHeaderSize)
+	if _, _, spanErr := seeker.TimeSpan(); !errors.Is(spanErr, ErrNoTimestamps) {
+		t.Errorf("expected no timestamps, got %v", spanErr)
+	}
+
+	_, limitErr := NewInSeekerWithOptions(bytes.NewReader(writeTestChunks(t, 3)), InStreamOptions{MaxChunkCount: 2})
+	var limit *LimitError
+	if !errors.As(limitErr, &limit) || limit.ChunkIndex != 2 || limit.Offset != fileHeaderSize+2*chunkSize {
+		t.Errorf("expected a limit error for chunk 2, got %v", limitErr)
+	}
+
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	if _, typeIDErr := NewTypeIDFromString("toolong"); !errors.Is(typeIDErr, ErrInvalidTypeID) {
+		t.Errorf("expected invalid type id, got %v", typeIDErr)
+	}
+	outStream.WriteTimestamp(10)
+	orderErr := outStream.WriteTimestamp(5)
+	expectChunkError(t, orderErr, ErrTimestampOrder, 1, fileHeaderSize+chunkHeaderOctetCount+8)
+	metadataErr := outStream.WriteMetadata(nil)
+	expectChunkError(t, metadataErr, ErrMetadataNotFirst, 1, fileHeaderSize+chunkHeaderOctetCount+8)
+	var chunkErr *ChunkError
+	if errors.As(metadataErr, &chunkErr) && chunkErr.TypeID != MetadataTypeID {
+		t.Errorf("wrong type id %v", chunkErr.TypeID)
+	}
+	outStream.WriteChunk(TypeRegistryTypeID, []byte{0xff})
+
+	failing, _ := NewOutStreamWriter(&failingWriter{octetCount: int(fileHeaderSize)})
+	writeErr := failing.WriteChunkTypeIDString("cafe", nil)
+	expectChunkError(t, writeErr, io.ErrShortWrite, 0, fileHeaderSize)
+	registrySeeker, _ := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	_, registryErr := registrySeeker.TypeRegistry()
+	expectChunkError(t, registryErr, ErrInvalidRegistry, 1, fileHeaderSize+chunkHeaderOctetCount+8)
+}
+
+func TestErrorsInTrailer(t *testing.T) {
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriterWithOptions(&buf, OutStreamOptions{Trailer: true})
+	outStream.WriteChunkTypeIDString("cafe", []byte("some payload"))
+	outStream.Close()
+	octets := buf.Bytes()
+	octets[len(octets)-trailerFooterOctetCount-1]++
+	_, trailerErr := NewReverseIterator(bytes.NewReader(octets))
+	var chunkErr *ChunkError
+	if !errors.Is(trailerErr, ErrBadTrailer) || !errors.As(trailerErr, &chunkErr) || chunkErr.TypeID != TrailerTypeID {
+		t.Errorf("expected a trailer ChunkError, got %v", trailerErr)
+	}
+}
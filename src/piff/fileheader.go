@@ -26,6 +26,51 @@ SOFTWARE.
 
 package piff
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type FileFormat int
+
+const (
+	FileFormatAuto FileFormat = iota
+	FileFormatPiff
+	FileFormatHeaderless
+)
+
+func (f FileFormat) String() string {
+	switch f {
+	case FileFormatAuto:
+		return "auto"
+	case FileFormatPiff:
+		return "piff"
+	case FileFormatHeaderless:
+		return "headerless"
+	}
+	return fmt.Sprintf("unknown file format %d", int(f))
+}
+
+func ParseFileFormat(name string) (FileFormat, error) {
+	for _, format := range []FileFormat{FileFormatAuto, FileFormatPiff, FileFormatHeaderless} {
+		if format.String() == name {
+			return format, nil
+		}
+	}
+	return FileFormatAuto, fmt.Errorf("%w '%v', expected auto, piff or headerless", ErrUnknownFormat, name)
+}
+
+// DetectedFormat describes how a file starts. Headerless files, like the
+// early ibdf recordings, start directly with the first chunk and have
+// Version zero.
+type DetectedFormat struct {
+	Format           FileFormat
+	Version          byte
+	HeaderOctetCount int
+}
+
 func fileFormatHeader() []byte {
 	return []byte{
 		0xF0, 0x9F, 0xA6, 0x95,
@@ -35,3 +80,72 @@ func fileFormatHeader() []byte {
 func fileFormatHeaderWithVersion(version byte) []byte {
 	return append(fileFormatHeader(), version)
 }
+
+// DetectFileFormat looks at the start of the file and seeks back to where it
+// started. Piff files with a version other than FileFormatVersion are
+// recognised, but returned together with an error.
+func DetectFileFormat(readSeeker io.ReadSeeker) (DetectedFormat, error) {
+	start, tellErr := readSeeker.Seek(0, io.SeekCurrent)
+	if tellErr != nil {
+		return DetectedFormat{}, tellErr
+	}
+	end, endErr := readSeeker.Seek(0, io.SeekEnd)
+	if endErr != nil {
+		return DetectedFormat{}, endErr
+	}
+	if _, seekErr := readSeeker.Seek(start, io.SeekStart); seekErr != nil {
+		return DetectedFormat{}, seekErr
+	}
+
+	magic := fileFormatHeader()
+	octets := make([]byte, len(magic)+1)
+	octetCount, readErr := io.ReadFull(readSeeker, octets)
+	if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+		return DetectedFormat{}, readErr
+	}
+	octets = octets[:octetCount]
+	if _, seekErr := readSeeker.Seek(start, io.SeekStart); seekErr != nil {
+		return DetectedFormat{}, seekErr
+	}
+
+	if bytes.HasPrefix(octets, magic) {
+		if len(octets) == len(magic) {
+			return DetectedFormat{}, &ChunkError{Err: ErrTruncated, Offset: start, Message: "file header has no version"}
+		}
+		detected := DetectedFormat{Format: FileFormatPiff, Version: octets[len(magic)], HeaderOctetCount: len(octets)}
+		if detected.Version != FileFormatVersion {
+			return detected, &ChunkError{Err: ErrUnsupportedVersion, Offset: start, Message: fmt.Sprintf("version %d, expected %d", detected.Version, FileFormatVersion)}
+		}
+		return detected, nil
+	}
+
+	if len(octets) >= chunkHeaderOctetCount && isPrintableTypeID(TypeID{octets[0], octets[1], octets[2], octets[3]}) {
+		octetLength := int64(binary.BigEndian.Uint32(octets[4:8]))
+		if start+chunkHeaderOctetCount+octetLength <= end {
+			return DetectedFormat{Format: FileFormatHeaderless}, nil
+		}
+	}
+
+	return DetectedFormat{}, &ChunkError{Err: ErrUnknownFormat, Offset: start, Message: "not a piff file or a headerless chunk stream"}
+}
+
+// readFileFormat leaves the reader at the first chunk.
+func readFileFormat(readSeeker io.ReadSeeker, format FileFormat) (DetectedFormat, error) {
+	switch format {
+	case FileFormatPiff:
+		if verifyErr := verifyFileHeader(readSeeker); verifyErr != nil {
+			return DetectedFormat{}, verifyErr
+		}
+		return DetectedFormat{Format: FileFormatPiff, Version: FileFormatVersion, HeaderOctetCount: len(fileFormatHeaderWithVersion(FileFormatVersion))}, nil
+	case FileFormatHeaderless:
+		return DetectedFormat{Format: FileFormatHeaderless}, nil
+	case FileFormatAuto:
+		detected, detectErr := DetectFileFormat(readSeeker)
+		if detectErr != nil {
+			return detected, detectErr
+		}
+		_, seekErr := readSeeker.Seek(int64(detected.HeaderOctetCount), io.SeekCurrent)
+		return detected, seekErr
+	}
+	return DetectedFormat{}, fmt.Errorf("%w %d", ErrUnknownFormat, int(format))
+}
@@ -0,0 +1,144 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+const fuzzMaxChunkCount = 1024
+
+func addFuzzSeeds(f *testing.F) {
+	sample, readErr := ioutil.ReadFile("../../bin/c61_short.ibdf")
+	if readErr != nil {
+		f.Fatal(readErr)
+	}
+	f.Add(sample)
+
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	outStream.WriteMetadata(map[string]string{MetadataApplication: "fuzz"})
+	outStream.WriteTypeRegistry(NewStandardTypeRegistry())
+	outStream.WriteTimestampedChunk(time.Millisecond, TimestampTypeID, timestampToOctets(time.Second))
+	outStream.WriteChunkTypeIDString("cafe", []byte("some payload"))
+	outStream.WriteChunkTypeIDString("empt", nil)
+	f.Add(buf.Bytes())
+	f.Add(buf.Bytes()[:buf.Len()-3])
+	f.Add(fileFormatHeaderWithVersion(FileFormatVersion))
+	f.Add([]byte{})
+}
+
+func FuzzNewInStream(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, octets []byte) {
+		inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(octets))
+		if inErr != nil {
+			return
+		}
+		inStream.Metadata()
+		inStream.PendingChunkHeader()
+	})
+}
+
+func FuzzReadChunk(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, octets []byte) {
+		for _, skip := range []bool{false, true} {
+			inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(octets))
+			if inErr != nil {
+				return
+			}
+			for i := 0; i < fuzzMaxChunkCount && !inStream.IsEOF(); i++ {
+				var readErr error
+				if skip {
+					_, readErr = inStream.SkipChunk()
+				} else {
+					var payload []byte
+					var header InHeader
+					header, payload, readErr = inStream.ReadChunk()
+					if readErr == nil && len(payload) != header.OctetCount() {
+						t.Fatalf("payload is %d octets, header says %d", len(payload), header.OctetCount())
+					}
+				}
+				if readErr != nil {
+					break
+				}
+			}
+		}
+	})
+}
+
+func FuzzNewInSeeker(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, octets []byte) {
+		seeker, seekerErr := NewInSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{MaxChunkCount: fuzzMaxChunkCount})
+		if seekerErr != nil {
+			return
+		}
+		for i := 0; i < seeker.ChunkCount(); i++ {
+			header, payload, findErr := seeker.FindChunk(i)
+			if findErr != nil {
+				t.Fatalf("chunk %d was indexed but can not be read: %v", i, findErr)
+			}
+			if len(payload) != header.OctetCount() {
+				t.Fatalf("payload is %d octets, header says %d", len(payload), header.OctetCount())
+			}
+		}
+		seeker.TypeRegistry()
+		seeker.Metadata()
+		if hasTimestamps, _ := seeker.HasTimestamps(); hasTimestamps {
+			seeker.TimeSpan()
+			seeker.ChunkIndexAtTime(time.Second)
+		}
+	})
+}
+
+func FuzzReverseIterator(f *testing.F) {
+	addFuzzSeeds(f)
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriterWithOptions(&buf, OutStreamOptions{Trailer: true})
+	outStream.WriteChunkTypeIDString("cafe", []byte("some payload"))
+	outStream.Close()
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, octets []byte) {
+		iterator, iteratorErr := NewReverseIterator(bytes.NewReader(octets))
+		if iteratorErr != nil {
+			return
+		}
+		for {
+			if _, _, nextErr := iterator.Next(); nextErr != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+func copyChunks(inStream *InStream, outStream *OutStream) error {
+	for {
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+		if writeErr := outStream.WriteChunk(header.TypeID(), payload); writeErr != nil {
+			return writeErr
+		}
+	}
+}
+
+// ImportHeaderless upgrades a headerless chunk stream, like the early ibdf
+// recordings, to a piff file with the current file header.
+func ImportHeaderless(reader io.Reader, outStream *OutStream) error {
+	readSeeker, isSeeker := reader.(io.ReadSeeker)
+	if !isSeeker {
+		octets, readErr := ioutil.ReadAll(reader)
+		if readErr != nil {
+			return readErr
+		}
+		readSeeker = bytes.NewReader(octets)
+	}
+	inStream, inErr := NewInStreamReadSeekerWithOptions(readSeeker, InStreamOptions{Format: FileFormatHeaderless})
+	if inErr != nil {
+		return inErr
+	}
+	return copyChunks(inStream, outStream)
+}
+
+// ExportHeaderless writes the chunks without the file header, for tools
+// that only read the legacy layout.
+func ExportHeaderless(inStream *InStream, writer io.Writer) error {
+	for {
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+		typeID := header.TypeID()
+		chunkHeader := make([]byte, chunkHeaderOctetCount)
+		copy(chunkHeader, typeID[:])
+		binary.BigEndian.PutUint32(chunkHeader[4:], uint32(len(payload)))
+		if _, writeErr := writer.Write(append(chunkHeader, payload...)); writeErr != nil {
+			return writeErr
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetectFileFormat(t *testing.T) {
+	legacy, readErr := ioutil.ReadFile("../../bin/c61_short.ibdf")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	current := writeTestChunks(t, 1)
+	future := append([]byte{}, current...)
+	future[9] = FileFormatVersion + 1
+
+	detected, detectErr := DetectFileFormat(bytes.NewReader(legacy))
+	if detectErr != nil || detected.Format != FileFormatHeaderless {
+		t.Errorf("legacy sample should be headerless, got %v %v", detected, detectErr)
+	}
+	detected, detectErr = DetectFileFormat(bytes.NewReader(current))
+	if detectErr != nil || detected.Format != FileFormatPiff || detected.Version != FileFormatVersion {
+		t.Errorf("wrong format %v %v", detected, detectErr)
+	}
+	detected, detectErr = DetectFileFormat(bytes.NewReader(future))
+	if detectErr == nil || detected.Format != FileFormatPiff || detected.Version != FileFormatVersion+1 {
+		t.Errorf("future version should be recognised and rejected, got %v %v", detected, detectErr)
+	}
+	if _, garbageErr := DetectFileFormat(bytes.NewReader([]byte("not \xff\xff\xff\xff"))); garbageErr == nil {
+		t.Errorf("expected error for garbage")
+	}
+
+	if _, forcedErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(legacy), InStreamOptions{Format: FileFormatPiff}); forcedErr == nil {
+		t.Errorf("forcing piff should reject the legacy sample")
+	}
+	forced, forcedErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(current[10:]), InStreamOptions{Format: FileFormatHeaderless})
+	if forcedErr != nil || !forced.PendingChunkHeader().TypeID().IsEqualString("cafe") {
+		t.Errorf("forcing headerless should read the first chunk, got %v", forcedErr)
+	}
+}
+
+func TestUpgradeHeaderless(t *testing.T) {
+	legacy, readErr := ioutil.ReadFile("../../bin/c61_short.ibdf")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	legacySeeker, legacyErr := NewInSeeker(bytes.NewReader(legacy))
+	if legacyErr != nil {
+		t.Fatal(legacyErr)
+	}
+
+	schemaTypeID, _ := NewTypeIDFromString("sch1")
+	upgraded := convertRoundTrip(t, legacy, ImportHeaderless, ExportHeaderless)
+	if upgraded.Format().Format != FileFormatPiff {
+		t.Errorf("upgraded file should have a file header")
+	}
+	if schemaCount, _ := upgraded.Count(schemaTypeID); upgraded.ChunkCount() != legacySeeker.ChunkCount() || schemaCount != 1 {
+		t.Errorf("wrong chunks %v", upgraded.AllHeaders())
+	}
+}
@@ -0,0 +1,90 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func newTestChunk(t *testing.T, typeID string, payload []byte) OutChunk {
+	fixedTypeID, typeIDErr := NewTypeIDFromString(typeID)
+	if typeIDErr != nil {
+		t.Fatal(typeIDErr)
+	}
+	return OutChunk{TypeID: fixedTypeID, Payload: payload}
+}
+
+// writeTestStream writes the chunks one at a time and closes the stream.
+func writeTestStream(t *testing.T, outStream *OutStream, chunks []OutChunk) {
+	for _, chunk := range chunks {
+		if writeErr := outStream.WriteChunk(chunk.TypeID, chunk.Payload); writeErr != nil {
+			t.Fatal(writeErr)
+		}
+	}
+	if closeErr := outStream.Close(); closeErr != nil {
+		t.Fatal(closeErr)
+	}
+}
+
+func writeTestFile(t *testing.T, options OutStreamOptions, chunks []OutChunk) []byte {
+	var buf bytes.Buffer
+	outStream, outErr := NewOutStreamWriterWithOptions(&buf, options)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	writeTestStream(t, outStream, chunks)
+	return buf.Bytes()
+}
+
+// writeTestChunks writes chunkCount "cafe" chunks that all have the same payload.
+func writeTestChunks(t *testing.T, chunkCount int) []byte {
+	chunks := make([]OutChunk, chunkCount)
+	for i := range chunks {
+		chunks[i] = newTestChunk(t, "cafe", []byte("some payload"))
+	}
+	return writeTestFile(t, OutStreamOptions{}, chunks)
+}
+
+// numberedTestChunks have the chunk index in the payload. Chunk 10 is a "tenn"
+// chunk, the others are "cafe" chunks.
+func numberedTestChunks(t *testing.T, chunkCount int) []OutChunk {
+	chunks := make([]OutChunk, chunkCount)
+	for i := range chunks {
+		typeID := "cafe"
+		if i == 10 {
+			typeID = "tenn"
+		}
+		chunks[i] = newTestChunk(t, typeID, []byte(fmt.Sprintf("chunk %d", i)))
+	}
+	return chunks
+}
+
+func writeNumberedChunks(t *testing.T, chunkCount int) []byte {
+	return writeTestFile(t, OutStreamOptions{}, numberedTestChunks(t, chunkCount))
+}
@@ -29,10 +29,18 @@ package piff
 import (
 	"fmt"
 	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
 )
 
 type InSeekHeader struct {
-	header InHeader
+	header       InHeader
+	timestamp    time.Duration
+	hasTimestamp bool
+	timestampErr error
 }
 
 func (i InSeekHeader) Header() InHeader {
@@ -43,26 +51,53 @@ func (i InSeekHeader) Tell() int64 {
 	return i.header.tell
 }
 
+func (i InSeekHeader) Timestamp() (time.Duration, bool) {
+	return i.timestamp, i.hasTimestamp
+}
+
+// TimestampErr tells why a timestamp chunk was not used. The chunk keeps
+// the timestamp that was in effect before it.
+func (i InSeekHeader) TimestampErr() error {
+	return i.timestampErr
+}
+
 func (i InSeekHeader) String() string {
 	return fmt.Sprintf("[inseekheader position:%v subheader:%v]", i.header.tell, i.header)
 }
 
 type InSeeker struct {
-	inFile      *InStream
-	seekHeaders []InSeekHeader
+	inFile           *InStream
+	seekHeaders      []InSeekHeader
+	typeIndex        map[TypeID][]int
+	typeIDs          []TypeID
+	timestampIndices []int
+	currentTimestamp time.Duration
+	hasTimestamp     bool
+	fromSidecar      bool
+	isFullyIndexed   bool
+	payloadCache     *payloadCache
+	mutex            sync.Mutex
 }
 
 func NewInSeekerFile(filename string) (*InSeeker, error) {
-	newFile, err := NewInStreamFile(filename)
+	newFile, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	return newInSeekerStream(newFile)
+	return NewInSeeker(newFile)
 }
 
 func NewInSeeker(readSeeker io.ReadSeeker) (*InSeeker, error) {
-	newFile, err := NewInStreamReadSeeker(readSeeker)
+	return NewInSeekerWithOptions(readSeeker, InStreamOptions{})
+}
+
+// NewInSeekerWithOptions only needs a complete file header. The chunks are
+// indexed by the seeker itself, so a partial chunk at the end of a file that
+// is still being written does not make it fail.
+func NewInSeekerWithOptions(readSeeker io.ReadSeeker, options InStreamOptions) (*InSeeker, error) {
+	options.ReadAheadChunkCount = 0
+	newFile, err := newInStreamWithoutChunks(readSeeker, options)
 	if err != nil {
 		return nil, err
 	}
@@ -72,44 +107,195 @@ func NewInSeeker(readSeeker io.ReadSeeker) (*InSeeker, error) {
 
 func newInSeekerStream(newFile *InStream) (*InSeeker, error) {
 	c := &InSeeker{
-		inFile: newFile,
+		inFile:    newFile,
+		typeIndex: make(map[TypeID][]int),
 	}
-	scanErr := c.scanAllChunks()
+	if newFile.options.PayloadCacheOctetCount > 0 {
+		c.payloadCache = newPayloadCache(newFile.options.PayloadCacheOctetCount)
+	}
+	if c.useSidecar() || newFile.options.LazyIndex {
+		return c, nil
+	}
+	scanErr := c.indexAll()
 	if scanErr != nil {
 		return nil, scanErr
 	}
 	return c, nil
 }
 
+// AllHeaders is Headers without the error. Only lazy seekers can fail to
+// index the rest of the file here, and then it returns the chunks indexed so far.
 func (c *InSeeker) AllHeaders() []InSeekHeader {
-	return c.seekHeaders
+	seekHeaders, _ := c.Headers()
+	return seekHeaders
+}
+
+// Headers indexes the whole file and returns the seek header of every chunk.
+func (c *InSeeker) Headers() ([]InSeekHeader, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	indexErr := c.indexAll()
+	return c.seekHeaders, indexErr
+}
+
+func (c *InSeeker) addSeekHeader(seekHeader InSeekHeader) {
+	index := len(c.seekHeaders)
+	c.seekHeaders = append(c.seekHeaders, seekHeader)
+	typeID := seekHeader.header.TypeID()
+	indices, wasFound := c.typeIndex[typeID]
+	if !wasFound {
+		c.typeIDs = append(c.typeIDs, typeID)
+	}
+	c.typeIndex[typeID] = append(indices, index)
+	if typeID == TimestampTypeID && seekHeader.timestampErr == nil {
+		c.timestampIndices = append(c.timestampIndices, index)
+	}
 }
 
-func (c *InSeeker) scanAllChunks() error {
-	var seekHeaders []InSeekHeader
-	for {
-		header, headerErr := c.inFile.SkipChunk()
-		if headerErr == io.EOF {
-			break
+// applyTimestamp does not fail the scan for a bad timestamp chunk, the
+// problem is kept in the seek header instead.
+func (c *InSeeker) applyTimestamp(header InHeader, payload []byte) InSeekHeader {
+	seekHeader := InSeekHeader{header: header, timestamp: c.currentTimestamp, hasTimestamp: c.hasTimestamp}
+	timestamp, timestampErr := TimestampFromOctets(payload)
+	if timestampErr != nil {
+		seekHeader.timestampErr = wrapChunkError(timestampErr, header)
+		return seekHeader
+	}
+	if c.hasTimestamp && timestamp < c.currentTimestamp {
+		seekHeader.timestampErr = newChunkError(ErrTimestampOrder, header, "timestamp %v is before the previous timestamp %v", timestamp, c.currentTimestamp)
+		return seekHeader
+	}
+	c.currentTimestamp = timestamp
+	c.hasTimestamp = true
+	return InSeekHeader{header: header, timestamp: timestamp, hasTimestamp: true}
+}
+
+// scanChunks indexes chunks until at least chunkCount chunks are indexed or
+// the file ends. Every scan starts at the end of the last indexed chunk and
+// measures the file again. A partial chunk at the end is not an error, it is
+// where the index ends until a Refresh finds it completed.
+func (c *InSeeker) scanChunks(chunkCount int) error {
+	if c.isFullyIndexed || len(c.seekHeaders) >= chunkCount {
+		return nil
+	}
+	stream := c.inFile
+	end, endErr := stream.inStream.Seek(0, io.SeekEnd)
+	if endErr != nil {
+		return endErr
+	}
+	tell := c.indexedEnd()
+	for len(c.seekHeaders) < chunkCount {
+		if end-tell < chunkHeaderOctetCount {
+			c.isFullyIndexed = true
+			return nil
 		}
+		if _, seekErr := stream.inStream.Seek(tell, io.SeekStart); seekErr != nil {
+			return seekErr
+		}
+		stream.chunkIndex = ChunkIndex(len(c.seekHeaders))
+		header, headerErr := stream.readHeaderInternal()
 		if headerErr != nil {
 			return headerErr
 		}
+		if limitErr := stream.checkLimits(header); limitErr != nil {
+			return limitErr
+		}
+		chunkEnd := tell + chunkHeaderOctetCount + int64(header.octetLength)
+		if chunkEnd > end {
+			c.isFullyIndexed = true
+			return nil
+		}
+		seekHeader := InSeekHeader{header: header, timestamp: c.currentTimestamp, hasTimestamp: c.hasTimestamp}
+		if header.TypeID().IsEqual(TimestampTypeID) {
+			payload, readErr := stream.internalRead(header, header.octetLength)
+			if readErr != nil {
+				return readErr
+			}
+			seekHeader = c.applyTimestamp(header, payload)
+		}
+		c.addSeekHeader(seekHeader)
+		tell = chunkEnd
+	}
+	return nil
+}
 
-		seekHeader := InSeekHeader{header: header}
-		seekHeaders = append(seekHeaders, seekHeader)
+// IndexAll indexes the rest of the file. Seekers that are not lazy are
+// always fully indexed. For lazy seekers the methods that need every chunk,
+// like ChunkCount and Count, call it, and IndexAll returns the error they
+// can not.
+func (c *InSeeker) IndexAll() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.indexAll()
+}
+
+func (c *InSeeker) indexAll() error {
+	return c.scanChunks(math.MaxInt32)
+}
+
+func (c *InSeeker) indexType(typeID TypeID, n int) error {
+	for len(c.typeIndex[typeID]) <= n && !c.isFullyIndexed {
+		if scanErr := c.scanChunks(len(c.seekHeaders) + 1); scanErr != nil {
+			return scanErr
+		}
 	}
-	c.seekHeaders = seekHeaders
 	return nil
 }
 
+// Refresh indexes the complete chunks that have been appended since the file
+// was scanned, without reading the chunks that are already indexed. A partial
+// chunk at the end is left for a later Refresh. It returns the number of new
+// chunks.
+func (c *InSeeker) Refresh() (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	indexedCount := len(c.seekHeaders)
+	c.isFullyIndexed = false
+	indexErr := c.indexAll()
+	return len(c.seekHeaders) - indexedCount, indexErr
+}
+
+// indexedEnd is the offset right after the last indexed chunk.
+func (c *InSeeker) indexedEnd() int64 {
+	if len(c.seekHeaders) == 0 {
+		return c.inFile.firstChunkTell
+	}
+	last := c.seekHeaders[len(c.seekHeaders)-1].header
+	return last.tell + chunkHeaderOctetCount + int64(last.octetLength)
+}
+
+// newIndexError is for chunks that are not in the index. The offset is where
+// the next chunk after the indexed ones would start. ChunkIndex is left unset,
+// since no chunk has been found.
+func (c *InSeeker) newIndexError(err error, typeID TypeID, format string, args ...interface{}) *ChunkError {
+	return &ChunkError{Err: err, Offset: c.indexedEnd(), TypeID: typeID, Message: fmt.Sprintf(format, args...)}
+}
+
+// ChunkCount is CountChunks without the error, see AllHeaders.
 func (c *InSeeker) ChunkCount() int {
-	return len(c.seekHeaders)
+	chunkCount, _ := c.CountChunks()
+	return chunkCount
+}
+
+func (c *InSeeker) CountChunks() (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	indexErr := c.indexAll()
+	return len(c.seekHeaders), indexErr
 }
 
 func (c *InSeeker) seekToChunk(index int) error {
-	if index >= len(c.seekHeaders) {
-		return fmt.Errorf("I don't have that index %d", index)
+	if index >= 0 {
+		if scanErr := c.scanChunks(index + 1); scanErr != nil {
+			return scanErr
+		}
+	}
+	if index < 0 || index >= len(c.seekHeaders) {
+		chunkErr := c.newIndexError(ErrIndexOutOfRange, TypeID{}, "chunk %d, there are %d chunks", index, len(c.seekHeaders))
+		if index >= 0 {
+			chunkErr.ChunkIndex = ChunkIndex(index)
+		}
+		return chunkErr
 	}
 
 	seekHeader := c.seekHeaders[index]
@@ -125,27 +311,249 @@ func (c *InSeeker) seekToChunkAndReadHeader(index int) (InHeader, error) {
 	if seekErr != nil {
 		return InHeader{}, seekErr
 	}
-	return c.inFile.readHeaderInternal()
+	header, headerErr := c.inFile.readHeaderInternal()
+	header.chunkIndex = ChunkIndex(index)
+	return header, headerErr
 }
 
-func (c *InSeeker) FindChunk(index int) (InHeader, []byte, error) {
+func (c *InSeeker) findChunk(index int) (InHeader, []byte, error) {
+	if c.payloadCache != nil {
+		if header, payload, wasFound := c.payloadCache.get(index); wasFound {
+			return header, payload, nil
+		}
+	}
 	header, headerErr := c.seekToChunkAndReadHeader(index)
 	if headerErr != nil {
 		return InHeader{}, nil, headerErr
 	}
-	payload, payloadErr := c.inFile.internalRead(header.octetLength)
+	payload, payloadErr := c.inFile.internalRead(header, header.octetLength)
+	if payloadErr == nil && c.payloadCache != nil {
+		c.payloadCache.add(index, header, payload)
+	}
 	return header, payload, payloadErr
 }
 
+func (c *InSeeker) FindChunk(index int) (InHeader, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.findChunk(index)
+}
+
+// findSeekHeader returns the chunk together with its seek header.
+func (c *InSeeker) findSeekHeader(index int) (InSeekHeader, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, payload, findErr := c.findChunk(index)
+	if findErr != nil {
+		return InSeekHeader{}, nil, findErr
+	}
+	return c.seekHeaders[index], payload, nil
+}
+
 func (c *InSeeker) FindPartialChunk(index int, octetCount int) (InHeader, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.payloadCache != nil {
+		if header, payload, wasFound := c.payloadCache.get(index); wasFound {
+			if checkErr := checkRequestedOctetCount(header, octetCount); checkErr != nil {
+				return InHeader{}, nil, checkErr
+			}
+			return header, payload[:octetCount], nil
+		}
+	}
 	header, headerErr := c.seekToChunkAndReadHeader(index)
 	if headerErr != nil {
 		return InHeader{}, nil, headerErr
 	}
-	payload, payloadErr := c.inFile.internalRead(octetCount)
+	if checkErr := checkRequestedOctetCount(header, octetCount); checkErr != nil {
+		return InHeader{}, nil, checkErr
+	}
+	payload, payloadErr := c.inFile.internalRead(header, octetCount)
 	return header, payload, payloadErr
 }
 
+func (c *InSeeker) Format() DetectedFormat {
+	return c.inFile.Format()
+}
+
+// Metadata works like InStream.Metadata.
+func (c *InSeeker) Metadata() (map[string]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if scanErr := c.scanChunks(1); scanErr != nil {
+		return nil, scanErr
+	}
+	if len(c.seekHeaders) == 0 || c.seekHeaders[0].header.typeID != MetadataTypeID {
+		return nil, nil
+	}
+	header, payload, findErr := c.findChunk(0)
+	if findErr != nil {
+		return nil, findErr
+	}
+	metadata, metadataErr := MetadataFromOctets(payload)
+	if metadataErr != nil {
+		return nil, wrapChunkError(metadataErr, header)
+	}
+	return metadata, nil
+}
+
+// TypeRegistry returns the registry from the first type registry chunk, or an
+// empty registry if the file has none.
+func (c *InSeeker) TypeRegistry() (*TypeRegistry, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexType(TypeRegistryTypeID, 0); indexErr != nil {
+		return nil, indexErr
+	}
+	indices := c.typeIndex[TypeRegistryTypeID]
+	if len(indices) == 0 {
+		return NewTypeRegistry(), nil
+	}
+	header, payload, findErr := c.findChunk(indices[0])
+	if findErr != nil {
+		return nil, findErr
+	}
+	registry, registryErr := NewTypeRegistryFromOctets(payload)
+	if registryErr != nil {
+		return nil, wrapChunkError(registryErr, header)
+	}
+	return registry, nil
+}
+
+func (c *InSeeker) TypeIDs() ([]TypeID, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return nil, indexErr
+	}
+	return append([]TypeID(nil), c.typeIDs...), nil
+}
+
+func (c *InSeeker) Count(typeID TypeID) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return 0, indexErr
+	}
+	return len(c.typeIndex[typeID]), nil
+}
+
+func (c *InSeeker) FindAll(typeID TypeID) ([]InSeekHeader, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return nil, indexErr
+	}
+	indices := c.typeIndex[typeID]
+	seekHeaders := make([]InSeekHeader, len(indices))
+	for i, index := range indices {
+		seekHeaders[i] = c.seekHeaders[index]
+	}
+	return seekHeaders, nil
+}
+
+func (c *InSeeker) FindFirst(typeID TypeID) (InHeader, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexType(typeID, 0); indexErr != nil {
+		return InHeader{}, nil, indexErr
+	}
+	indices := c.typeIndex[typeID]
+	if len(indices) == 0 {
+		return InHeader{}, nil, c.newIndexError(ErrNotFound, typeID, "no chunk with type id '%v'", typeID)
+	}
+	return c.findChunk(indices[0])
+}
+
+func (c *InSeeker) FindNth(typeID TypeID, n int) (InHeader, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexType(typeID, n); indexErr != nil {
+		return InHeader{}, nil, indexErr
+	}
+	indices := c.typeIndex[typeID]
+	if n < 0 || n >= len(indices) {
+		return InHeader{}, nil, c.newIndexError(ErrNotFound, typeID, "no chunk %d with type id '%v', there are %d", n, typeID, len(indices))
+	}
+	return c.findChunk(indices[n])
+}
+
+// ForEachOfType does not hold the lock while the handler runs, so the
+// handler may use the seeker.
+func (c *InSeeker) ForEachOfType(typeID TypeID, handler ChunkHandler) error {
+	c.mutex.Lock()
+	indexErr := c.indexAll()
+	indices := append([]int(nil), c.typeIndex[typeID]...)
+	c.mutex.Unlock()
+	if indexErr != nil {
+		return indexErr
+	}
+	for _, index := range indices {
+		header, payload, findErr := c.FindChunk(index)
+		if findErr != nil {
+			return findErr
+		}
+		if handlerErr := handler(header, payload); handlerErr != nil {
+			return handlerErr
+		}
+	}
+	return nil
+}
+
+// HasTimestamps only counts timestamp chunks that could be used.
+func (c *InSeeker) HasTimestamps() (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return false, indexErr
+	}
+	return len(c.timestampIndices) > 0, nil
+}
+
+func (c *InSeeker) TimeSpan() (time.Duration, time.Duration, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return 0, 0, indexErr
+	}
+	markers := c.timestampIndices
+	if len(markers) == 0 {
+		return 0, 0, ErrNoTimestamps
+	}
+	first := c.seekHeaders[markers[0]].timestamp
+	last := c.seekHeaders[markers[len(markers)-1]].timestamp
+	return first, last, nil
+}
+
+// ChunkIndexAtTime returns the index of the timestamp chunk that is in effect
+// at the given time, so reading from there gives every chunk from that time
+// onwards. Times before the first timestamp give the first timestamp chunk.
+func (c *InSeeker) ChunkIndexAtTime(timestamp time.Duration) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return 0, indexErr
+	}
+	markers := c.timestampIndices
+	if len(markers) == 0 {
+		return 0, ErrNoTimestamps
+	}
+	markerTimestamp := func(i int) time.Duration {
+		return c.seekHeaders[markers[i]].timestamp
+	}
+	after := sort.Search(len(markers), func(i int) bool {
+		return markerTimestamp(i) > timestamp
+	})
+	if after == 0 {
+		return markers[0], nil
+	}
+	inEffect := markerTimestamp(after - 1)
+	first := sort.Search(after, func(i int) bool {
+		return markerTimestamp(i) >= inEffect
+	})
+	return markers[first], nil
+}
+
 func (c *InSeeker) Close() {
 	c.inFile.Close()
 }
@@ -27,6 +27,7 @@ SOFTWARE.
 package piff
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -71,3 +72,55 @@ func TestFetchChunks(t *testing.T) {
 	}
 	i.Close()
 }
+
+func TestTypeIndex(t *testing.T) {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	f.WriteChunkTypeIDString("sch1", []byte("schema"))
+	for i := 0; i < 4; i++ {
+		f.WriteChunkTypeIDString("pkt1", []byte(fmt.Sprintf("packet %d", i)))
+		f.WriteChunkTypeIDString("tick", []byte{byte(i)})
+	}
+
+	i, err := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemaTypeID, _ := NewTypeIDFromString("sch1")
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+	missingTypeID, _ := NewTypeIDFromString("none")
+
+	packetCount, _ := i.Count(packetTypeID)
+	schemaCount, _ := i.Count(schemaTypeID)
+	missingCount, _ := i.Count(missingTypeID)
+	if packetCount != 4 || schemaCount != 1 || missingCount != 0 {
+		t.Errorf("wrong counts")
+	}
+	typeIDs, typeIDsErr := i.TypeIDs()
+	if typeIDsErr != nil || len(typeIDs) != 3 || typeIDs[0] != schemaTypeID || typeIDs[1] != packetTypeID {
+		t.Errorf("wrong type ids %v", typeIDs)
+	}
+	_, payload, findErr := i.FindFirst(schemaTypeID)
+	if findErr != nil || string(payload) != "schema" {
+		t.Errorf("wrong first schema %v %v", string(payload), findErr)
+	}
+	if _, _, missingErr := i.FindFirst(missingTypeID); missingErr == nil {
+		t.Errorf("expected error for missing type id")
+	}
+	all, allErr := i.FindAll(packetTypeID)
+	if allErr != nil || len(all) != 4 || all[3].Header().ChunkIndex() != 7 {
+		t.Errorf("wrong packet headers %v", all)
+	}
+	header, payload, nthErr := i.FindNth(packetTypeID, 2)
+	if nthErr != nil || string(payload) != "packet 2" || header.ChunkIndex() != 5 {
+		t.Errorf("wrong nth packet %v %v", header, string(payload))
+	}
+	var packets []string
+	i.ForEachOfType(packetTypeID, func(header InHeader, payload []byte) error {
+		packets = append(packets, string(payload))
+		return nil
+	})
+	if len(packets) != 4 || packets[0] != "packet 0" {
+		t.Errorf("wrong iteration %v", packets)
+	}
+}
@@ -41,6 +41,10 @@ func (i InHeader) TypeIDString() string {
 	return string(i.typeID[0:])
 }
 
+func (i InHeader) TypeID() TypeID {
+	return i.typeID
+}
+
 func (i InHeader) OctetCount() int {
 	return i.octetLength
 }
@@ -36,11 +36,45 @@ import (
 )
 
 type InStream struct {
-	inStream      io.ReadSeeker
-	pendingHeader InHeader
-	isEOF         bool
-	seekHeaders   []InSeekHeader
-	chunkIndex    ChunkIndex
+	inStream       io.ReadSeeker
+	pendingHeader  InHeader
+	isEOF          bool
+	seekHeaders    []InSeekHeader
+	chunkIndex     ChunkIndex
+	metadata       map[string]string
+	metadataErr    error
+	format         DetectedFormat
+	options        InStreamOptions
+	firstChunkTell int64
+	limitErr       error
+	readAhead      *readAhead
+}
+
+// InStreamOptions.Format defaults to FileFormatAuto, which accepts both piff
+// files and headerless chunk streams. The limits are meant for files from
+// untrusted sources, zero or nil means no limit. MaxTotalOctetCount counts
+// chunk headers and payloads, but not the file header. IgnoreSidecar makes
+// an InSeeker scan the file even if it has a fresh sidecar index, and
+// LazyIndex makes it only index as far as the chunks asked for.
+// PayloadCacheOctetCount gives an InSeeker a least recently used cache of
+// payloads that holds at most that many octets.
+//
+// ReadAheadChunkCount makes ReadChunk, ReadPartChunk and SkipChunk read up to
+// that many chunks ahead in a goroutine. ReadAheadOctetCount limits how many
+// payload octets may wait to be read, zero means no limit. Skipped chunks are
+// still read by the goroutine. InSeeker does not read ahead, since it reads at
+// random positions.
+type InStreamOptions struct {
+	Format                 FileFormat
+	MaxChunkOctetCount     int
+	MaxTotalOctetCount     int64
+	MaxChunkCount          int
+	AllowedTypeIDs         []TypeID
+	IgnoreSidecar          bool
+	LazyIndex              bool
+	PayloadCacheOctetCount int64
+	ReadAheadChunkCount    int
+	ReadAheadOctetCount    int64
 }
 
 func NewInStreamFile(filename string) (*InStream, error) {
@@ -51,57 +85,188 @@ func NewInStreamFile(filename string) (*InStream, error) {
 	return NewInStreamReadSeeker(newFile)
 }
 
-func verifyFileHeader(reader io.Reader) error {
-	expectedHeader := fileFormatHeaderWithVersion(FileFormatVersion)
-	fileHeaderPayload := make([]byte, len(expectedHeader))
-	_, readErr := reader.Read(fileHeaderPayload)
+func verifyFileHeader(readSeeker io.ReadSeeker) error {
+	tell, tellErr := readSeeker.Seek(0, io.SeekCurrent)
+	if tellErr != nil {
+		return tellErr
+	}
+	magic := fileFormatHeader()
+	fileHeaderPayload := make([]byte, len(magic)+1)
+	_, readErr := io.ReadFull(readSeeker, fileHeaderPayload)
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		return &ChunkError{Err: ErrTruncated, Offset: tell, Message: "file header"}
+	}
 	if readErr != nil {
-		return fmt.Errorf("piff: couldnt read file header %v", readErr)
+		return readErr
+	}
+	if !bytes.Equal(fileHeaderPayload[:len(magic)], magic) {
+		return &ChunkError{Err: ErrBadMagic, Offset: tell}
 	}
-	if !bytes.Equal(fileHeaderPayload, expectedHeader) {
-		return fmt.Errorf("piff: not a valid piff file header")
+	version := fileHeaderPayload[len(magic)]
+	if version != FileFormatVersion {
+		return &ChunkError{Err: ErrUnsupportedVersion, Offset: tell, Message: fmt.Sprintf("version %d, expected %d", version, FileFormatVersion)}
 	}
 
 	return nil
 }
 
 func NewInStreamReadSeeker(inStream io.ReadSeeker) (*InStream, error) {
-	c := &InStream{
-		inStream: inStream,
+	return NewInStreamReadSeekerWithOptions(inStream, InStreamOptions{})
+}
+
+// newInStreamWithoutChunks only reads the file header. It is used by
+// InSeeker, which reads the chunk headers itself.
+func newInStreamWithoutChunks(inStream io.ReadSeeker, options InStreamOptions) (*InStream, error) {
+	format, formatErr := readFileFormat(inStream, options.Format)
+	if formatErr != nil {
+		return nil, formatErr
 	}
-	fileHeaderErr := verifyFileHeader(inStream)
-	if fileHeaderErr != nil {
-		return nil, fileHeaderErr
+	firstChunkTell, tellErr := inStream.Seek(0, io.SeekCurrent)
+	if tellErr != nil {
+		return nil, tellErr
+	}
+	return &InStream{
+		inStream:       inStream,
+		format:         format,
+		options:        options,
+		firstChunkTell: firstChunkTell,
+	}, nil
+}
+
+func NewInStreamReadSeekerWithOptions(inStream io.ReadSeeker, options InStreamOptions) (*InStream, error) {
+	c, newErr := newInStreamWithoutChunks(inStream, options)
+	if newErr != nil {
+		return nil, newErr
 	}
 	headerErr := c.readHeader()
-	return c, headerErr
+	if headerErr != nil {
+		return c, headerErr
+	}
+	metadataErr := c.peekMetadata()
+	if metadataErr != nil {
+		return c, metadataErr
+	}
+	if options.ReadAheadChunkCount > 0 {
+		c.startReadAhead()
+	}
+	return c, nil
+}
+
+func (c *InStream) peekMetadata() error {
+	if c.isEOF || c.limitErr != nil || !c.pendingHeader.TypeID().IsEqual(MetadataTypeID) {
+		return nil
+	}
+	payload, readErr := c.internalRead(c.pendingHeader, c.pendingHeader.octetLength)
+	if readErr != nil {
+		return readErr
+	}
+	_, seekErr := c.inStream.Seek(c.pendingHeader.tell+chunkHeaderOctetCount, io.SeekStart)
+	if seekErr != nil {
+		return seekErr
+	}
+	metadata, metadataErr := MetadataFromOctets(payload)
+	if metadataErr != nil {
+		c.metadataErr = wrapChunkError(metadataErr, c.pendingHeader)
+		return nil
+	}
+	c.metadata = metadata
+	return nil
+}
+
+func (c *InStream) Format() DetectedFormat {
+	return c.format
+}
+
+// Metadata returns the pairs from the metadata chunk, or nil if the file has
+// none. The metadata chunk is still returned by ReadChunk, also when it can
+// not be parsed. The parse error is a *ChunkError wrapping ErrInvalidMetadata.
+func (c *InStream) Metadata() (map[string]string, error) {
+	return c.metadata, c.metadataErr
+}
+
+// Large payloads are read in parts, so a damaged octet count in a chunk
+// header can not allocate much more memory than the file holds.
+const payloadPartOctetCount = 1024 * 1024
+
+func readPayload(reader io.Reader, octetCount int) ([]byte, int, error) {
+	if octetCount <= payloadPartOctetCount {
+		payload := make([]byte, octetCount)
+		readCount, readErr := io.ReadFull(reader, payload)
+		return payload, readCount, readErr
+	}
+	payload := make([]byte, 0, payloadPartOctetCount)
+	for len(payload) < octetCount {
+		partOctetCount := octetCount - len(payload)
+		if partOctetCount > payloadPartOctetCount {
+			partOctetCount = payloadPartOctetCount
+		}
+		start := len(payload)
+		payload = append(payload, make([]byte, partOctetCount)...)
+		readCount, readErr := io.ReadFull(reader, payload[start:])
+		if readErr != nil {
+			return nil, start + readCount, readErr
+		}
+	}
+	return payload, octetCount, nil
+}
+
+// checkRequestedOctetCount is done before anything is allocated for a partial
+// read.
+func checkRequestedOctetCount(header InHeader, requestedOctetCount int) error {
+	if requestedOctetCount < 0 || requestedOctetCount > header.octetLength {
+		return newChunkError(ErrInvalidOctetCount, header, "requested %d octets from a payload of %d octets", requestedOctetCount, header.octetLength)
+	}
+	return nil
 }
 
-func (c *InStream) internalRead(requestedOctetCount int) ([]byte, error) {
-	payload := make([]byte, requestedOctetCount)
-	_, err := c.inStream.Read(payload)
+func (c *InStream) internalRead(header InHeader, requestedOctetCount int) ([]byte, error) {
+	if requestedOctetCount == 0 {
+		return []byte{}, nil
+	}
+	payload, octetCount, err := readPayload(c.inStream, requestedOctetCount)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, newChunkError(ErrTruncated, header, "only %d of %d payload octets", octetCount, requestedOctetCount)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return payload, nil
 }
 
+// verifyChunkEnd is called at the end of the stream. Skipping a payload
+// seeks, which does not fail when the file ends too early, so the previous
+// chunk is checked against the file size instead.
+func (c *InStream) verifyChunkEnd(previousHeader InHeader) error {
+	if c.chunkIndex == 0 {
+		return nil
+	}
+	chunkEnd := previousHeader.tell + chunkHeaderOctetCount + int64(previousHeader.octetLength)
+	end, endErr := c.inStream.Seek(0, io.SeekEnd)
+	if endErr != nil {
+		return endErr
+	}
+	if end < chunkEnd {
+		return newChunkError(ErrTruncated, previousHeader, "payload ends at %d but the file ends at %d", chunkEnd, end)
+	}
+	return nil
+}
+
 func (c *InStream) readHeaderInternal() (InHeader, error) {
 	pendingHeader := make([]byte, 8)
 	tell, tellErr := c.inStream.Seek(0, 1)
 	if tellErr != nil {
 		return InHeader{}, tellErr
 	}
-	octetCount, err := c.inStream.Read(pendingHeader)
+	octetCount, err := io.ReadFull(c.inStream, pendingHeader)
 	if err == io.EOF {
 		return InHeader{}, io.EOF
 	}
+	if err == io.ErrUnexpectedEOF {
+		return InHeader{}, newChunkError(ErrTruncated, InHeader{tell: tell, chunkIndex: c.chunkIndex}, "only %d of %d chunk header octets", octetCount, chunkHeaderOctetCount)
+	}
 	if err != nil {
 		return InHeader{}, err
 	}
-	if octetCount != 8 {
-		return InHeader{}, fmt.Errorf("piff: couldn't read whole pendingHeader")
-	}
 	s := instream.New(pendingHeader)
 
 	typeID, readErr := s.ReadOctets(4)
@@ -120,9 +285,13 @@ func (c *InStream) readHeaderInternal() (InHeader, error) {
 }
 
 func (c *InStream) readHeader() error {
+	previousHeader := c.pendingHeader
 	var err error
 	c.pendingHeader, err = c.readHeaderInternal()
 	if err == io.EOF {
+		if endErr := c.verifyChunkEnd(previousHeader); endErr != nil {
+			return endErr
+		}
 		c.isEOF = true
 		err = nil
 	}
@@ -130,6 +299,9 @@ func (c *InStream) readHeader() error {
 	if err != nil {
 		return err
 	}
+	if !c.isEOF {
+		c.limitErr = c.checkLimits(c.pendingHeader)
+	}
 	return nil
 }
 
@@ -137,22 +309,22 @@ func (c *InStream) internalReadChunk(requestedOctetCount int) (InHeader, []byte,
 	if c.isEOF {
 		return InHeader{}, nil, io.EOF
 	}
-	if requestedOctetCount > c.pendingHeader.octetLength {
-		return InHeader{}, nil, fmt.Errorf("trying to read too much")
-	}
-	skipCount := c.pendingHeader.octetLength - requestedOctetCount
-	payload := make([]byte, requestedOctetCount)
-	octetsRead, err := c.inStream.Read(payload)
-	if err != nil {
-		return InHeader{}, nil, err
+	if c.limitErr != nil {
+		return InHeader{}, nil, c.limitErr
 	}
-	if skipCount > 0 {
-		c.inStream.Seek(int64(skipCount), 1)
+	if checkErr := checkRequestedOctetCount(c.pendingHeader, requestedOctetCount); checkErr != nil {
+		return InHeader{}, nil, checkErr
 	}
 	savedHeader := c.pendingHeader
-
-	if octetsRead+skipCount != savedHeader.octetLength {
-		return InHeader{}, nil, fmt.Errorf("couldnt read the whole payload read:%v, skip:%v expected:%v", octetsRead, skipCount, savedHeader.octetLength)
+	payload, readErr := c.internalRead(savedHeader, requestedOctetCount)
+	if readErr != nil {
+		return InHeader{}, nil, readErr
+	}
+	skipCount := savedHeader.octetLength - requestedOctetCount
+	if skipCount > 0 {
+		if _, seekErr := c.inStream.Seek(int64(skipCount), io.SeekCurrent); seekErr != nil {
+			return InHeader{}, nil, seekErr
+		}
 	}
 	c.chunkIndex++
 	headerErr := c.readHeader()
@@ -160,10 +332,16 @@ func (c *InStream) internalReadChunk(requestedOctetCount int) (InHeader, []byte,
 }
 
 func (c *InStream) ReadChunk() (InHeader, []byte, error) {
+	if c.readAhead != nil {
+		return c.readPrefetchedChunk(c.pendingHeader.OctetCount())
+	}
 	return c.internalReadChunk(c.pendingHeader.OctetCount())
 }
 
 func (c *InStream) ReadPartChunk(requestedOctetCount int) (InHeader, []byte, error) {
+	if c.readAhead != nil {
+		return c.readPrefetchedChunk(requestedOctetCount)
+	}
 	return c.internalReadChunk(requestedOctetCount)
 }
 
@@ -176,16 +354,28 @@ func (c *InStream) IsEOF() bool {
 }
 
 func (c *InStream) SkipChunk() (InHeader, error) {
+	if c.readAhead != nil {
+		chunk := c.nextPrefetchedChunk()
+		return chunk.header, chunk.err
+	}
 	if c.isEOF {
 		return InHeader{}, io.EOF
 	}
+	if c.limitErr != nil {
+		return InHeader{}, c.limitErr
+	}
 	savedHeader := c.pendingHeader
-	c.inStream.Seek(int64(savedHeader.OctetCount()), 1)
+	if _, seekErr := c.inStream.Seek(int64(savedHeader.OctetCount()), io.SeekCurrent); seekErr != nil {
+		return InHeader{}, seekErr
+	}
 	c.chunkIndex++
 	headerErr := c.readHeader()
 	return savedHeader, headerErr
 }
 
 func (c *InStream) Close() {
+	if c.readAhead != nil {
+		c.readAhead.close()
+	}
 	//c.inStream.Close()
 }
@@ -0,0 +1,143 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+type jsonChunk struct {
+	TypeID    string  `json:"typeID,omitempty"`
+	TypeIDHex string  `json:"typeIDHex,omitempty"`
+	UTF8      *string `json:"utf8,omitempty"`
+	Base64    *string `json:"base64,omitempty"`
+}
+
+func isPrintableTypeID(typeID TypeID) bool {
+	for _, octet := range typeID {
+		if octet < 0x20 || octet > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newJSONChunk(typeID TypeID, payload []byte) jsonChunk {
+	var chunk jsonChunk
+	if isPrintableTypeID(typeID) {
+		chunk.TypeID = string(typeID[:])
+	} else {
+		chunk.TypeIDHex = hex.EncodeToString(typeID[:])
+	}
+	if utf8.Valid(payload) {
+		text := string(payload)
+		chunk.UTF8 = &text
+	} else {
+		encoded := base64.StdEncoding.EncodeToString(payload)
+		chunk.Base64 = &encoded
+	}
+	return chunk
+}
+
+func (c jsonChunk) decode() (TypeID, []byte, error) {
+	var typeIDOctets []byte
+	switch {
+	case c.TypeID != "" && c.TypeIDHex != "":
+		return TypeID{}, nil, fmt.Errorf("both typeID and typeIDHex are set")
+	case c.TypeIDHex != "":
+		var hexErr error
+		typeIDOctets, hexErr = hex.DecodeString(c.TypeIDHex)
+		if hexErr != nil {
+			return TypeID{}, nil, hexErr
+		}
+	default:
+		typeIDOctets = []byte(c.TypeID)
+	}
+	typeID, typeIDErr := NewTypeIDFromOctets(typeIDOctets)
+	if typeIDErr != nil {
+		return TypeID{}, nil, typeIDErr
+	}
+
+	switch {
+	case c.UTF8 != nil && c.Base64 != nil:
+		return TypeID{}, nil, fmt.Errorf("both utf8 and base64 are set")
+	case c.UTF8 != nil:
+		return typeID, []byte(*c.UTF8), nil
+	case c.Base64 != nil:
+		payload, base64Err := base64.StdEncoding.DecodeString(*c.Base64)
+		return typeID, payload, base64Err
+	}
+	return TypeID{}, nil, fmt.Errorf("missing utf8 or base64 payload")
+}
+
+// ExportJSONLines writes one JSON object per chunk. Payloads that are valid
+// UTF-8 are stored as text, everything else as base64.
+func ExportJSONLines(inStream *InStream, writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for {
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+		encodeErr := encoder.Encode(newJSONChunk(TypeID(header.typeID), payload))
+		if encodeErr != nil {
+			return encodeErr
+		}
+	}
+}
+
+func ImportJSONLines(reader io.Reader, outStream *OutStream) error {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	for chunkIndex := 0; ; chunkIndex++ {
+		var chunk jsonChunk
+		decodeErr := decoder.Decode(&chunk)
+		if decodeErr == io.EOF {
+			return nil
+		}
+		if decodeErr != nil {
+			return fmt.Errorf("piff: json chunk %d: %v", chunkIndex, decodeErr)
+		}
+		typeID, payload, chunkErr := chunk.decode()
+		if chunkErr != nil {
+			return fmt.Errorf("piff: json chunk %d: %v", chunkIndex, chunkErr)
+		}
+		writeErr := outStream.WriteChunk(typeID, payload)
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func roundTripJSONLines(t *testing.T, original []byte) string {
+	inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(original))
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	var jsonLines bytes.Buffer
+	exportErr := ExportJSONLines(inStream, &jsonLines)
+	if exportErr != nil {
+		t.Fatal(exportErr)
+	}
+
+	var rebuilt bytes.Buffer
+	outStream, outErr := NewOutStreamWriter(&rebuilt)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	importErr := ImportJSONLines(bytes.NewReader(jsonLines.Bytes()), outStream)
+	if importErr != nil {
+		t.Fatal(importErr)
+	}
+	if !bytes.Equal(original, rebuilt.Bytes()) {
+		t.Errorf("round trip is not byte identical:\n%v", jsonLines.String())
+	}
+	return jsonLines.String()
+}
+
+func TestJSONLinesRoundTrip(t *testing.T) {
+	var original bytes.Buffer
+	f, outErr := NewOutStreamWriter(&original)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	f.WriteChunkTypeIDString("sch1", []byte("enum Some\n  Value 1\n<&>\"quoted\"\n"))
+	f.WriteChunkTypeIDString("pkt1", []byte{0x81, 0x00, 0xff, 0xfe, 0x18})
+	f.WriteChunkTypeIDString("empt", []byte{})
+	f.WriteChunk(TypeID{0x00, 0xff, 'a', '\n'}, []byte("åäö"))
+
+	jsonLines := roundTripJSONLines(t, original.Bytes())
+	lines := strings.Split(strings.TrimSpace(jsonLines), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected one line per chunk, got %d", len(lines))
+	}
+	if lines[2] != `{"typeID":"empt","utf8":""}` {
+		t.Errorf("unexpected empty chunk line %v", lines[2])
+	}
+	if !strings.Contains(lines[3], `"typeIDHex":"00ff610a"`) {
+		t.Errorf("unprintable type id should be hex %v", lines[3])
+	}
+}
+
+func TestJSONLinesImportErrors(t *testing.T) {
+	var rebuilt bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&rebuilt)
+	badLines := []string{
+		`{"typeID":"toolong","utf8":""}`,
+		`{"typeID":"cafe"}`,
+		`{"typeID":"cafe","utf8":"","base64":""}`,
+		`{"typeID":"cafe","base64":"!!!"}`,
+		`{"typeID":"cafe","unknown":1}`,
+	}
+	for _, line := range badLines {
+		importErr := ImportJSONLines(strings.NewReader(line), outStream)
+		if importErr == nil {
+			t.Errorf("expected error for %v", line)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLazyIndex(t *testing.T) {
+	octets := writeNumberedChunks(t, 20)
+	seeker, seekerErr := NewInSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{LazyIndex: true})
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	if len(seeker.seekHeaders) != 0 {
+		t.Fatalf("nothing should be indexed yet, got %d", len(seeker.seekHeaders))
+	}
+
+	expectChunk := func(index int, expectedIndexed int) {
+		_, payload, findErr := seeker.FindChunk(index)
+		if findErr != nil || string(payload) != fmt.Sprintf("chunk %d", index) {
+			t.Errorf("wrong chunk %d: %q %v", index, payload, findErr)
+		}
+		if len(seeker.seekHeaders) != expectedIndexed {
+			t.Errorf("expected %d indexed chunks, got %d", expectedIndexed, len(seeker.seekHeaders))
+		}
+	}
+	expectChunk(3, 4)
+	expectChunk(1, 4)
+	expectChunk(7, 8)
+
+	tenn, _ := NewTypeIDFromString("tenn")
+	if header, _, findErr := seeker.FindFirst(tenn); findErr != nil || header.ChunkIndex() != 10 {
+		t.Errorf("wrong first chunk %v %v", header, findErr)
+	}
+	if len(seeker.seekHeaders) != 11 {
+		t.Errorf("should index up to the first match, got %d", len(seeker.seekHeaders))
+	}
+
+	if seeker.ChunkCount() != 20 {
+		t.Errorf("wrong chunk count %d", seeker.ChunkCount())
+	}
+	expectChunk(19, 20)
+}
+
+func TestLazyIndexTruncated(t *testing.T) {
+	octets := writeNumberedChunks(t, 5)
+	seeker, seekerErr := NewInSeekerWithOptions(bytes.NewReader(octets[:len(octets)-2]), InStreamOptions{LazyIndex: true})
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	if _, _, findErr := seeker.FindChunk(0); findErr != nil {
+		t.Errorf("the first chunk should be readable, got %v", findErr)
+	}
+	if indexErr := seeker.IndexAll(); indexErr != nil {
+		t.Errorf("the partial chunk should end the index, got %v", indexErr)
+	}
+	if seeker.ChunkCount() != 4 {
+		t.Errorf("wrong chunk count %d", seeker.ChunkCount())
+	}
+	if _, _, findErr := seeker.FindChunk(4); !errors.Is(findErr, ErrIndexOutOfRange) {
+		t.Errorf("expected index out of range, got %v", findErr)
+	}
+}
+
+func TestLazyIndexErrors(t *testing.T) {
+	seeker, seekerErr := NewInSeekerWithOptions(bytes.NewReader(writeNumberedChunks(t, 5)), InStreamOptions{LazyIndex: true, MaxChunkCount: 3})
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	cafe, _ := NewTypeIDFromString("cafe")
+	_, countChunksErr := seeker.CountChunks()
+	_, headersErr := seeker.Headers()
+	_, countErr := seeker.Count(cafe)
+	_, findAllErr := seeker.FindAll(cafe)
+	_, typeIDsErr := seeker.TypeIDs()
+	_, hasTimestampsErr := seeker.HasTimestamps()
+	for _, indexErr := range []error{countChunksErr, headersErr, countErr, findAllErr, typeIDsErr, hasTimestampsErr} {
+		if !errors.Is(indexErr, ErrLimitExceeded) {
+			t.Errorf("expected limit exceeded, got %v", indexErr)
+		}
+	}
+	if seeker.ChunkCount() != 3 {
+		t.Errorf("ChunkCount should give the indexed chunks, got %d", seeker.ChunkCount())
+	}
+}
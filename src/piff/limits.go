@@ -0,0 +1,103 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import "fmt"
+
+type LimitKind int
+
+const (
+	LimitChunkOctetCount LimitKind = iota + 1
+	LimitTotalOctetCount
+	LimitChunkCount
+	LimitTypeID
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case LimitChunkOctetCount:
+		return "chunk octet count"
+	case LimitTotalOctetCount:
+		return "total octet count"
+	case LimitChunkCount:
+		return "chunk count"
+	case LimitTypeID:
+		return "type id"
+	}
+	return fmt.Sprintf("unknown limit %d", int(k))
+}
+
+// LimitError is returned instead of the chunk that breaks one of the limits
+// in InStreamOptions. Offset is the octet offset of the chunk header. Limit
+// and Value are unused for LimitTypeID.
+type LimitError struct {
+	Kind       LimitKind
+	ChunkIndex ChunkIndex
+	Offset     int64
+	TypeID     TypeID
+	Limit      int64
+	Value      int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Kind == LimitTypeID {
+		return fmt.Sprintf("piff: chunk %d at offset %d has type id '%v' which is not allowed", e.ChunkIndex, e.Offset, e.TypeID)
+	}
+	return fmt.Sprintf("piff: chunk %d '%v' at offset %d exceeds the %v limit: %d > %d", e.ChunkIndex, e.TypeID, e.Offset, e.Kind, e.Value, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// checkLimits is called for every chunk header before anything is allocated
+// for the payload.
+func (c *InStream) checkLimits(header InHeader) error {
+	options := c.options
+	newLimitError := func(kind LimitKind, limit int64, value int64) error {
+		return &LimitError{Kind: kind, ChunkIndex: header.chunkIndex, Offset: header.tell, TypeID: header.typeID, Limit: limit, Value: value}
+	}
+	if options.MaxChunkCount > 0 && int64(header.chunkIndex) >= int64(options.MaxChunkCount) {
+		return newLimitError(LimitChunkCount, int64(options.MaxChunkCount), int64(header.chunkIndex)+1)
+	}
+	if options.MaxChunkOctetCount > 0 && header.octetLength > options.MaxChunkOctetCount {
+		return newLimitError(LimitChunkOctetCount, int64(options.MaxChunkOctetCount), int64(header.octetLength))
+	}
+	totalOctetCount := header.tell + chunkHeaderOctetCount + int64(header.octetLength) - c.firstChunkTell
+	if options.MaxTotalOctetCount > 0 && totalOctetCount > options.MaxTotalOctetCount {
+		return newLimitError(LimitTotalOctetCount, options.MaxTotalOctetCount, totalOctetCount)
+	}
+	if options.AllowedTypeIDs != nil {
+		for _, allowed := range options.AllowedTypeIDs {
+			if allowed == header.typeID {
+				return nil
+			}
+		}
+		return newLimitError(LimitTypeID, 0, 0)
+	}
+	return nil
+}
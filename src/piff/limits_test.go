@@ -0,0 +1,98 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func expectLimitError(t *testing.T, err error, kind LimitKind, chunkIndex ChunkIndex) {
+	limitErr, isLimitErr := err.(*LimitError)
+	if !isLimitErr {
+		t.Fatalf("expected limit error, got %v", err)
+	}
+	if limitErr.Kind != kind || limitErr.ChunkIndex != chunkIndex {
+		t.Errorf("expected %v limit in chunk %d, got %v", kind, chunkIndex, limitErr)
+	}
+}
+
+func readAllChunks(octets []byte, options InStreamOptions) (int, error) {
+	inStream, inErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(octets), options)
+	if inErr != nil {
+		return 0, inErr
+	}
+	chunkCount := 0
+	for !inStream.IsEOF() {
+		if _, _, readErr := inStream.ReadChunk(); readErr != nil {
+			return chunkCount, readErr
+		}
+		chunkCount++
+	}
+	return chunkCount, nil
+}
+
+func TestLimits(t *testing.T) {
+	octets := writeTestChunks(t, 3)
+	chunkOctetCount := int64(chunkHeaderOctetCount + len("some payload"))
+
+	chunkCount, countErr := readAllChunks(octets, InStreamOptions{MaxChunkCount: 2})
+	if chunkCount != 2 {
+		t.Errorf("should read the chunks within the limit, read %d", chunkCount)
+	}
+	expectLimitError(t, countErr, LimitChunkCount, 2)
+
+	_, sizeErr := readAllChunks(octets, InStreamOptions{MaxChunkOctetCount: 4})
+	expectLimitError(t, sizeErr, LimitChunkOctetCount, 0)
+
+	_, totalErr := readAllChunks(octets, InStreamOptions{MaxTotalOctetCount: chunkOctetCount*2 + 1})
+	expectLimitError(t, totalErr, LimitTotalOctetCount, 2)
+
+	other, _ := NewTypeIDFromString("othr")
+	_, typeErr := readAllChunks(octets, InStreamOptions{AllowedTypeIDs: []TypeID{other}})
+	expectLimitError(t, typeErr, LimitTypeID, 0)
+
+	cafe, _ := NewTypeIDFromString("cafe")
+	exactOptions := InStreamOptions{
+		MaxChunkCount:      3,
+		MaxChunkOctetCount: len("some payload"),
+		MaxTotalOctetCount: chunkOctetCount * 3,
+		AllowedTypeIDs:     []TypeID{cafe},
+	}
+	if chunkCount, exactErr := readAllChunks(octets, exactOptions); exactErr != nil || chunkCount != 3 {
+		t.Errorf("limits are inclusive, got %d %v", chunkCount, exactErr)
+	}
+}
+
+func TestLimitHugeChunk(t *testing.T) {
+	octets := writeTestChunks(t, 1)
+	binary.BigEndian.PutUint32(octets[len(octets)-len("some payload")-4:], 0xffffffff)
+
+	_, seekerErr := NewInSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{MaxChunkOctetCount: 1024})
+	expectLimitError(t, seekerErr, LimitChunkOctetCount, 0)
+}
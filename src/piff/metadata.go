@@ -0,0 +1,108 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/piot/brook-go/src/instream"
+	"github.com/piot/brook-go/src/outstream"
+)
+
+// The metadata chunk, if present, is the first chunk in the file. It holds
+// key/value pairs, each as a length prefixed key and a length prefixed value.
+var MetadataTypeID = TypeID{'m', 'e', 't', '1'}
+
+const (
+	MetadataApplication = "application"
+	MetadataBuild       = "build"
+	MetadataCreated     = "created"
+	MetadataSession     = "session"
+)
+
+func writeLengthPrefixedString(s *outstream.OutStream, value string) {
+	s.WriteUint32(uint32(len(value)))
+	s.WriteOctets([]byte(value))
+}
+
+// maxOctetCount is the size of the whole payload, so a broken length can not
+// cause a large allocation.
+func readLengthPrefixedString(s *instream.InStream, maxOctetCount int) (string, error) {
+	octetCount, countErr := s.ReadUint32()
+	if countErr != nil {
+		return "", countErr
+	}
+	if int64(octetCount) > int64(maxOctetCount) {
+		return "", fmt.Errorf("string length %d is longer than the payload", octetCount)
+	}
+	octets, readErr := s.ReadOctets(int(octetCount))
+	if readErr != nil {
+		return "", readErr
+	}
+	return string(octets), nil
+}
+
+func SortedMetadataKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func metadataToOctets(metadata map[string]string) []byte {
+	s := outstream.New()
+	s.WriteUint32(uint32(len(metadata)))
+	for _, key := range SortedMetadataKeys(metadata) {
+		writeLengthPrefixedString(s, key)
+		writeLengthPrefixedString(s, metadata[key])
+	}
+	return s.Octets()
+}
+
+func MetadataFromOctets(payload []byte) (map[string]string, error) {
+	s := instream.New(payload)
+	pairCount, countErr := s.ReadUint32()
+	if countErr != nil {
+		return nil, fmt.Errorf("%w: pair count: %v", ErrInvalidMetadata, countErr)
+	}
+	metadata := make(map[string]string)
+	for i := uint32(0); i < pairCount; i++ {
+		key, keyErr := readLengthPrefixedString(s, len(payload))
+		if keyErr != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidMetadata, i, keyErr)
+		}
+		value, valueErr := readLengthPrefixedString(s, len(payload))
+		if valueErr != nil {
+			return nil, fmt.Errorf("%w: value for '%v': %v", ErrInvalidMetadata, key, valueErr)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
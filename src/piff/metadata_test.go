@@ -0,0 +1,118 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	metadata := map[string]string{
+		MetadataApplication: "blob game",
+		MetadataBuild:       "1.2.3",
+		MetadataSession:     "",
+	}
+	writeErr := f.WriteMetadata(metadata)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	f.WriteChunkTypeIDString("cafe", []byte("payload"))
+	if f.WriteMetadata(metadata) == nil {
+		t.Errorf("metadata should only be allowed first")
+	}
+
+	inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(buf.Bytes()))
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	readMetadata, metadataErr := inStream.Metadata()
+	if metadataErr != nil {
+		t.Fatal(metadataErr)
+	}
+	if len(readMetadata) != 3 || readMetadata[MetadataBuild] != "1.2.3" {
+		t.Errorf("wrong metadata %v", readMetadata)
+	}
+	if _, hasSession := readMetadata[MetadataSession]; !hasSession {
+		t.Errorf("empty values should be kept")
+	}
+	header, _, _ := inStream.ReadChunk()
+	if !header.TypeID().IsEqual(MetadataTypeID) {
+		t.Errorf("metadata chunk should still be read as a chunk")
+	}
+	_, payload, _ := inStream.ReadChunk()
+	if string(payload) != "payload" {
+		t.Errorf("wrong payload after metadata %v", string(payload))
+	}
+
+	seeker, _ := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if seekerMetadata, _ := seeker.Metadata(); seekerMetadata[MetadataApplication] != "blob game" {
+		t.Errorf("wrong seeker metadata %v", seekerMetadata)
+	}
+}
+
+func TestMalformedMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	f.WriteChunk(MetadataTypeID, []byte{0, 0, 0, 5, 1})
+	f.WriteChunkTypeIDString("cafe", []byte("payload"))
+	metadataOffset := int64(len(fileFormatHeaderWithVersion(FileFormatVersion)))
+
+	expectMetadataErr := func(metadata map[string]string, metadataErr error) {
+		var chunkErr *ChunkError
+		if metadata != nil || !errors.Is(metadataErr, ErrInvalidMetadata) || !errors.As(metadataErr, &chunkErr) {
+			t.Fatalf("expected invalid metadata chunk error, got %v %v", metadata, metadataErr)
+		}
+		if chunkErr.Offset != metadataOffset || chunkErr.ChunkIndex != 0 || !chunkErr.TypeID.IsEqual(MetadataTypeID) {
+			t.Errorf("wrong position in %v", chunkErr)
+		}
+	}
+
+	inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(buf.Bytes()))
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	expectMetadataErr(inStream.Metadata())
+	if header, _, _ := inStream.ReadChunk(); !header.TypeID().IsEqual(MetadataTypeID) {
+		t.Errorf("the metadata chunk should be read as a normal chunk, got %v", header)
+	}
+	if _, payload, readErr := inStream.ReadChunk(); readErr != nil || string(payload) != "payload" {
+		t.Errorf("the chunk after the metadata should be readable, got %v", readErr)
+	}
+
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	expectMetadataErr(seeker.Metadata())
+	if seeker.ChunkCount() != 2 {
+		t.Errorf("both chunks should be indexed, got %d", seeker.ChunkCount())
+	}
+}
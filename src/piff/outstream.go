@@ -29,20 +29,36 @@ package piff
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"time"
 
 	"github.com/piot/brook-go/src/outstream"
 )
 
 type OutStream struct {
-	writer io.Writer
-	file   *os.File
+	writer        io.Writer
+	file          *os.File
+	vectorFile    *os.File
+	lastTimestamp time.Duration
+	hasTimestamp  bool
+	chunkCount    int
+	hasTrailer    bool
+	octetCounts   []uint32
+	coalesced     []byte
+	octetCount    int64
 }
 
-func writeFileHeader(writer io.Writer) error {
+// OutStreamOptions.Trailer adds a trailer chunk on Close, so the file can be
+// read backwards with a ReverseIterator.
+type OutStreamOptions struct {
+	Trailer bool
+}
+
+func writeFileHeader(writer io.Writer) (int64, error) {
 	header := fileFormatHeaderWithVersion(FileFormatVersion)
 	_, writeErr := writer.Write(header)
-	return writeErr
+	return int64(len(header)), writeErr
 }
 
 func NewOutStream(filename string) (*OutStream, error) {
@@ -55,18 +71,32 @@ func NewOutStream(filename string) (*OutStream, error) {
 }
 
 func NewOutStreamWriter(writer io.Writer) (*OutStream, error) {
+	return NewOutStreamWriterWithOptions(writer, OutStreamOptions{})
+}
+
+// NewOutStreamWriterWithOptions does not sync or close the writer, but an
+// *os.File is still written with writev by WriteChunks.
+func NewOutStreamWriterWithOptions(writer io.Writer, options OutStreamOptions) (*OutStream, error) {
+	vectorFile, _ := writer.(*os.File)
 	c := &OutStream{
-		writer: writer,
+		writer:     writer,
+		vectorFile: vectorFile,
+		hasTrailer: options.Trailer,
 	}
-	writeFileHeaderErr := writeFileHeader(writer)
+	headerOctetCount, writeFileHeaderErr := writeFileHeader(writer)
 	if writeFileHeaderErr != nil {
 		return nil, writeFileHeaderErr
 	}
+	c.octetCount = headerOctetCount
 	return c, nil
 }
 
 func NewOutStreamFile(file *os.File) (*OutStream, error) {
-	c, newErr := NewOutStreamWriter(file)
+	return NewOutStreamFileWithOptions(file, OutStreamOptions{})
+}
+
+func NewOutStreamFileWithOptions(file *os.File, options OutStreamOptions) (*OutStream, error) {
+	c, newErr := NewOutStreamWriterWithOptions(file, options)
 	if newErr != nil {
 		return nil, newErr
 	}
@@ -76,35 +106,90 @@ func NewOutStreamFile(file *os.File) (*OutStream, error) {
 }
 
 func (c *OutStream) WriteChunkTypeIDString(typeID string, payload []byte) error {
-	fixedTypeID := TypeID{
-		byte(typeID[0]),
-		byte(typeID[1]),
-		byte(typeID[2]),
-		byte(typeID[3]),
+	fixedTypeID, typeIDErr := NewTypeIDFromString(typeID)
+	if typeIDErr != nil {
+		return typeIDErr
 	}
 	return c.WriteChunk(fixedTypeID, payload)
 }
 
+// newChunkError tells where the next chunk would have been written.
+func (c *OutStream) newChunkError(err error, typeID TypeID, format string, args ...interface{}) *ChunkError {
+	return &ChunkError{Err: err, ChunkIndex: ChunkIndex(c.chunkCount), Offset: c.octetCount, TypeID: typeID, Message: fmt.Sprintf(format, args...)}
+}
+
 func (c *OutStream) WriteChunk(typeID TypeID, payload []byte) error {
-	s := outstream.New()
-	typeIDOctets := typeID[0:]
-	if len(typeIDOctets) != 4 {
-		return fmt.Errorf("wrong conversion")
+	if int64(len(payload)) > math.MaxUint32 {
+		return c.newChunkError(ErrInvalidOctetCount, typeID, "payload of %d octets does not fit in a chunk", len(payload))
 	}
-	s.WriteOctets(typeIDOctets)
+	s := outstream.New()
+	s.WriteOctets(typeID[0:])
 	octetCount := len(payload)
 	s.WriteUint32(uint32(octetCount))
 	s.WriteOctets(payload)
 	filePayload := s.Octets()
-	c.writer.Write(filePayload)
+	if _, writeErr := c.writer.Write(filePayload); writeErr != nil {
+		return c.newChunkError(writeErr, typeID, "")
+	}
+	c.chunkCount++
+	c.octetCount += int64(len(filePayload))
+	if c.hasTrailer {
+		c.octetCounts = append(c.octetCounts, uint32(octetCount))
+	}
 	if c.file != nil {
 		c.file.Sync()
 	}
 	return nil
 }
 
-func (c *OutStream) Close() {
+func (c *OutStream) WriteMetadata(metadata map[string]string) error {
+	if c.chunkCount != 0 {
+		return c.newChunkError(ErrMetadataNotFirst, MetadataTypeID, "%d chunks have already been written", c.chunkCount)
+	}
+	return c.WriteChunk(MetadataTypeID, metadataToOctets(metadata))
+}
+
+func (c *OutStream) WriteTypeRegistry(registry *TypeRegistry) error {
+	return c.WriteChunk(TypeRegistryTypeID, registry.Octets())
+}
+
+func (c *OutStream) WriteTimestamp(timestamp time.Duration) error {
+	if timestamp < 0 {
+		return c.newChunkError(ErrInvalidTimestamp, TimestampTypeID, "timestamp %v is negative", timestamp)
+	}
+	if c.hasTimestamp && timestamp < c.lastTimestamp {
+		return c.newChunkError(ErrTimestampOrder, TimestampTypeID, "timestamp %v is before the previous timestamp %v", timestamp, c.lastTimestamp)
+	}
+	writeErr := c.WriteChunk(TimestampTypeID, timestampToOctets(timestamp))
+	if writeErr != nil {
+		return writeErr
+	}
+	c.lastTimestamp = timestamp
+	c.hasTimestamp = true
+	return nil
+}
+
+// WriteTimestampedChunk only writes a timestamp chunk when the timestamp
+// differs from the previous one, so chunks from the same tick share it.
+func (c *OutStream) WriteTimestampedChunk(timestamp time.Duration, typeID TypeID, payload []byte) error {
+	if !c.hasTimestamp || timestamp != c.lastTimestamp {
+		timestampErr := c.WriteTimestamp(timestamp)
+		if timestampErr != nil {
+			return timestampErr
+		}
+	}
+	return c.WriteChunk(typeID, payload)
+}
+
+func (c *OutStream) Close() error {
+	if c.hasTrailer {
+		c.hasTrailer = false
+		if trailerErr := c.WriteChunk(TrailerTypeID, trailerToOctets(c.octetCounts)); trailerErr != nil {
+			return trailerErr
+		}
+	}
 	if c.file != nil {
-		c.file.Close()
+		return c.file.Close()
 	}
+	return nil
 }
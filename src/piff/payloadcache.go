@@ -0,0 +1,106 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import "container/list"
+
+type PayloadCacheStats struct {
+	HitCount      uint64
+	MissCount     uint64
+	EvictionCount uint64
+	EntryCount    int
+	OctetCount    int64
+}
+
+type payloadCacheEntry struct {
+	index   int
+	header  InHeader
+	payload []byte
+}
+
+// payloadCache is a least recently used cache of payloads, bounded by the
+// sum of the payload octet counts. It is only used while the InSeeker lock
+// is held. Payloads are copied in and out, so callers can not change the
+// cached octets.
+type payloadCache struct {
+	maxOctetCount int64
+	entries       map[int]*list.Element
+	order         *list.List
+	stats         PayloadCacheStats
+}
+
+func newPayloadCache(maxOctetCount int64) *payloadCache {
+	return &payloadCache{
+		maxOctetCount: maxOctetCount,
+		entries:       make(map[int]*list.Element),
+		order:         list.New(),
+	}
+}
+
+func (c *payloadCache) get(index int) (InHeader, []byte, bool) {
+	element, wasFound := c.entries[index]
+	if !wasFound {
+		c.stats.MissCount++
+		return InHeader{}, nil, false
+	}
+	c.stats.HitCount++
+	c.order.MoveToFront(element)
+	entry := element.Value.(*payloadCacheEntry)
+	return entry.header, append([]byte{}, entry.payload...), true
+}
+
+func (c *payloadCache) add(index int, header InHeader, payload []byte) {
+	octetCount := int64(len(payload))
+	if octetCount > c.maxOctetCount {
+		return
+	}
+	if _, wasFound := c.entries[index]; wasFound {
+		return
+	}
+	for c.stats.OctetCount+octetCount > c.maxOctetCount {
+		oldest := c.order.Back()
+		oldestEntry := c.order.Remove(oldest).(*payloadCacheEntry)
+		delete(c.entries, oldestEntry.index)
+		c.stats.OctetCount -= int64(len(oldestEntry.payload))
+		c.stats.EvictionCount++
+	}
+	entry := &payloadCacheEntry{index: index, header: header, payload: append([]byte{}, payload...)}
+	c.entries[index] = c.order.PushFront(entry)
+	c.stats.OctetCount += octetCount
+}
+
+// PayloadCacheStats returns zero stats if the seeker has no payload cache.
+func (c *InSeeker) PayloadCacheStats() PayloadCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.payloadCache == nil {
+		return PayloadCacheStats{}
+	}
+	stats := c.payloadCache.stats
+	stats.EntryCount = len(c.payloadCache.entries)
+	return stats
+}
@@ -0,0 +1,92 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPayloadCache(t *testing.T) {
+	octets := writeNumberedChunks(t, 20)
+	chunkOctetCount := int64(len("chunk 10"))
+	seeker, seekerErr := NewInSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{PayloadCacheOctetCount: chunkOctetCount * 2})
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+
+	for _, index := range []int{10, 11, 10, 11, 12, 10} {
+		_, payload, findErr := seeker.FindChunk(index)
+		if findErr != nil || string(payload) != fmt.Sprintf("chunk %d", index) {
+			t.Fatalf("wrong chunk %d %q %v", index, payload, findErr)
+		}
+		payload[0] = 'X'
+	}
+	stats := seeker.PayloadCacheStats()
+	expected := PayloadCacheStats{HitCount: 2, MissCount: 4, EvictionCount: 2, EntryCount: 2, OctetCount: chunkOctetCount * 2}
+	if stats != expected {
+		t.Errorf("wrong stats %+v, expected %+v", stats, expected)
+	}
+
+	_, part, _ := seeker.FindPartialChunk(10, 5)
+	if string(part) != "chunk" || seeker.PayloadCacheStats().HitCount != 3 {
+		t.Errorf("partial read should use the cache, got %q", part)
+	}
+}
+
+func TestPayloadCacheConcurrent(t *testing.T) {
+	octets := writeNumberedChunks(t, 50)
+	seeker, _ := NewInSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{LazyIndex: true, PayloadCacheOctetCount: 64})
+	tenn, _ := NewTypeIDFromString("tenn")
+
+	var wait sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wait.Add(1)
+		go func(worker int) {
+			defer wait.Done()
+			for i := 0; i < 200; i++ {
+				index := (worker*7 + i) % 50
+				_, payload, findErr := seeker.FindChunk(index)
+				if findErr != nil || string(payload) != fmt.Sprintf("chunk %d", index) {
+					t.Errorf("wrong chunk %d %q %v", index, payload, findErr)
+					return
+				}
+				if i%50 == 0 {
+					seeker.FindFirst(tenn)
+					seeker.ChunkCount()
+				}
+			}
+		}(worker)
+	}
+	wait.Wait()
+	stats := seeker.PayloadCacheStats()
+	if stats.HitCount+stats.MissCount != 8*(200+4) || stats.OctetCount > 64 {
+		t.Errorf("wrong stats %+v", stats)
+	}
+}
@@ -0,0 +1,410 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type PlayerChunk struct {
+	Header    InHeader
+	Payload   []byte
+	Timestamp time.Duration
+}
+
+// PlayerOptions.Loop starts over from the first chunk when the file ends. It
+// needs an InSeeker.
+type PlayerOptions struct {
+	Speed float64
+	Loop  bool
+}
+
+// playerSource hands out the chunks in file order, each with the timestamp
+// in effect for it.
+type playerSource interface {
+	readChunk() (PlayerChunk, bool, error)
+	seek(index int) error
+}
+
+type seekerPlayerSource struct {
+	seeker *InSeeker
+	index  int
+}
+
+func (s *seekerPlayerSource) readChunk() (PlayerChunk, bool, error) {
+	seekHeader, payload, findErr := s.seeker.findSeekHeader(s.index)
+	if errors.Is(findErr, ErrIndexOutOfRange) {
+		return PlayerChunk{}, false, io.EOF
+	}
+	if findErr != nil {
+		return PlayerChunk{}, false, findErr
+	}
+	s.index++
+	timestamp, hasTimestamp := seekHeader.Timestamp()
+	return PlayerChunk{Header: seekHeader.Header(), Payload: payload, Timestamp: timestamp}, hasTimestamp, nil
+}
+
+func (s *seekerPlayerSource) seek(index int) error {
+	s.index = index
+	return nil
+}
+
+// streamPlayerSource follows the timestamp chunks itself, and skips the ones
+// that can not be parsed or go backwards, like InSeeker does.
+type streamPlayerSource struct {
+	inStream     *InStream
+	timestamp    time.Duration
+	hasTimestamp bool
+}
+
+func (s *streamPlayerSource) readChunk() (PlayerChunk, bool, error) {
+	header, payload, readErr := s.inStream.ReadChunk()
+	if readErr != nil {
+		return PlayerChunk{}, false, readErr
+	}
+	if header.typeID == TimestampTypeID {
+		timestamp, timestampErr := TimestampFromOctets(payload)
+		if timestampErr == nil && (!s.hasTimestamp || timestamp >= s.timestamp) {
+			s.timestamp = timestamp
+			s.hasTimestamp = true
+		}
+	}
+	return PlayerChunk{Header: header, Payload: payload, Timestamp: s.timestamp}, s.hasTimestamp, nil
+}
+
+func (s *streamPlayerSource) seek(index int) error {
+	return fmt.Errorf("piff: a player on an InStream can not seek")
+}
+
+type pendingPlayerChunk struct {
+	chunk        PlayerChunk
+	hasTimestamp bool
+}
+
+// Player emits chunks at the pace given by the timestamp chunks. Timestamp
+// chunks themselves are not emitted. Chunks before the first timestamp are
+// emitted right away. A player on an InStream reads the chunks as it plays
+// them, a player on an InSeeker can also seek and loop. Play runs on one
+// goroutine, the control functions may be called from any other.
+type Player struct {
+	source  playerSource
+	seeker  *InSeeker
+	wake    chan struct{}
+	pending *pendingPlayerChunk
+
+	mutex       sync.Mutex
+	speed       float64
+	loop        bool
+	paused      bool
+	stopped     bool
+	hasSeek     bool
+	seekIndex   int
+	isAnchored  bool
+	anchorWall  time.Time
+	anchorMedia time.Duration
+	position    time.Duration
+}
+
+func newPlayer(source playerSource, seeker *InSeeker, options PlayerOptions) (*Player, error) {
+	speed := options.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	if speed < 0 {
+		return nil, fmt.Errorf("piff: player speed %v must be positive", speed)
+	}
+	return &Player{
+		source: source,
+		seeker: seeker,
+		wake:   make(chan struct{}, 1),
+		speed:  speed,
+		loop:   options.Loop,
+	}, nil
+}
+
+func NewPlayer(seeker *InSeeker, options PlayerOptions) (*Player, error) {
+	return newPlayer(&seekerPlayerSource{seeker: seeker}, seeker, options)
+}
+
+// NewStreamPlayer plays the chunks as they are read from the stream, without
+// indexing the file first.
+func NewStreamPlayer(inStream *InStream, options PlayerOptions) (*Player, error) {
+	if options.Loop {
+		return nil, fmt.Errorf("piff: a player on an InStream can not loop")
+	}
+	return newPlayer(&streamPlayerSource{inStream: inStream}, nil, options)
+}
+
+func (p *Player) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// mediaPositionLocked must be called with the mutex held.
+func (p *Player) mediaPositionLocked(now time.Time) time.Duration {
+	if !p.isAnchored || p.paused {
+		return p.position
+	}
+	return p.anchorMedia + time.Duration(float64(now.Sub(p.anchorWall))*p.speed)
+}
+
+func (p *Player) reanchorLocked(now time.Time) {
+	if p.isAnchored {
+		p.anchorMedia = p.mediaPositionLocked(now)
+		p.anchorWall = now
+	}
+}
+
+func (p *Player) Position() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.mediaPositionLocked(time.Now())
+}
+
+func (p *Player) SetSpeed(speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("piff: player speed %v must be positive", speed)
+	}
+	p.mutex.Lock()
+	p.reanchorLocked(time.Now())
+	p.speed = speed
+	p.mutex.Unlock()
+	p.signal()
+	return nil
+}
+
+func (p *Player) SetLoop(loop bool) error {
+	if loop && p.seeker == nil {
+		return fmt.Errorf("piff: a player on an InStream can not loop")
+	}
+	p.mutex.Lock()
+	p.loop = loop
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *Player) Pause() {
+	p.mutex.Lock()
+	if !p.paused {
+		p.position = p.mediaPositionLocked(time.Now())
+		p.paused = true
+	}
+	p.mutex.Unlock()
+	p.signal()
+}
+
+func (p *Player) Resume() {
+	p.mutex.Lock()
+	if p.paused {
+		p.paused = false
+		p.anchorWall = time.Now()
+		p.anchorMedia = p.position
+	}
+	p.mutex.Unlock()
+	p.signal()
+}
+
+func (p *Player) IsPaused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.paused
+}
+
+// SeekTime continues playback from the timestamp chunk in effect at the
+// given time. It needs a player on an InSeeker.
+func (p *Player) SeekTime(timestamp time.Duration) error {
+	if p.seeker == nil {
+		return fmt.Errorf("piff: a player on an InStream can not seek")
+	}
+	index, findErr := p.seeker.ChunkIndexAtTime(timestamp)
+	if findErr != nil {
+		return findErr
+	}
+	p.mutex.Lock()
+	p.hasSeek = true
+	p.seekIndex = index
+	p.isAnchored = false
+	p.mutex.Unlock()
+	p.signal()
+	return nil
+}
+
+func (p *Player) Stop() {
+	p.mutex.Lock()
+	p.stopped = true
+	p.mutex.Unlock()
+	p.signal()
+}
+
+// applySeek moves the source to the chunk asked for by the last SeekTime.
+func (p *Player) applySeek() error {
+	p.mutex.Lock()
+	hasSeek := p.hasSeek
+	index := p.seekIndex
+	p.hasSeek = false
+	p.mutex.Unlock()
+	if !hasSeek {
+		return nil
+	}
+	p.pending = nil
+	return p.source.seek(index)
+}
+
+// readPending reads the next chunk, starting over at the end when looping.
+// It returns false when playback is over.
+func (p *Player) readPending() (bool, error) {
+	chunk, hasTimestamp, readErr := p.source.readChunk()
+	if readErr == io.EOF {
+		p.mutex.Lock()
+		loop := p.loop && !p.stopped
+		p.isAnchored = false
+		p.mutex.Unlock()
+		if !loop {
+			return false, nil
+		}
+		if seekErr := p.source.seek(0); seekErr != nil {
+			return false, seekErr
+		}
+		chunk, hasTimestamp, readErr = p.source.readChunk()
+		if readErr == io.EOF {
+			return false, nil
+		}
+	}
+	if readErr != nil {
+		return false, readErr
+	}
+	p.pending = &pendingPlayerChunk{chunk: chunk, hasTimestamp: hasTimestamp}
+	return true, nil
+}
+
+// nextDue tells how long to wait before the pending chunk is due. It returns
+// false when playback is stopped, and a negative wait while paused.
+func (p *Player) nextDue() (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.stopped {
+		return 0, false
+	}
+	if p.paused {
+		return time.Duration(-1), true
+	}
+	if !p.pending.hasTimestamp {
+		return 0, true
+	}
+	timestamp := p.pending.chunk.Timestamp
+	now := time.Now()
+	if !p.isAnchored {
+		p.isAnchored = true
+		p.anchorWall = now
+		p.anchorMedia = timestamp
+		p.position = timestamp
+	}
+	due := p.anchorWall.Add(time.Duration(float64(timestamp-p.anchorMedia) / p.speed))
+	wait := due.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// claim tells if the pending chunk may be emitted, which it may not if
+// playback was stopped, paused or moved by a seek while waiting.
+func (p *Player) claim() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return !p.stopped && !p.paused && !p.hasSeek
+}
+
+func (p *Player) play(emit func(chunk PlayerChunk) error) error {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		if seekErr := p.applySeek(); seekErr != nil {
+			return seekErr
+		}
+		if p.pending == nil {
+			isPlaying, readErr := p.readPending()
+			if readErr != nil || !isPlaying {
+				return readErr
+			}
+		}
+		wait, isPlaying := p.nextDue()
+		if !isPlaying {
+			return nil
+		}
+		if wait < 0 {
+			<-p.wake
+			continue
+		}
+		if wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-p.wake:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				continue
+			}
+		}
+		if !p.claim() {
+			continue
+		}
+		chunk := p.pending.chunk
+		p.pending = nil
+		if chunk.Header.TypeID().IsEqual(TimestampTypeID) {
+			continue
+		}
+		if emitErr := emit(chunk); emitErr != nil {
+			return emitErr
+		}
+	}
+}
+
+func (p *Player) Play(handler ChunkHandler) error {
+	return p.play(func(chunk PlayerChunk) error {
+		return handler(chunk.Header, chunk.Payload)
+	})
+}
+
+// PlayChannel plays into the channel and closes it when playback is over.
+func (p *Player) PlayChannel(chunks chan<- PlayerChunk) error {
+	defer close(chunks)
+	return p.play(func(chunk PlayerChunk) error {
+		chunks <- chunk
+		return nil
+	})
+}
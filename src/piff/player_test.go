@@ -0,0 +1,222 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+const playerTickCount = 5
+const playerTickDuration = 20 * time.Millisecond
+
+func newPlayerTestSeeker(t *testing.T) *InSeeker {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+	f.WriteChunkTypeIDString("sch1", []byte("schema"))
+	for tick := 0; tick < playerTickCount; tick++ {
+		f.WriteTimestampedChunk(time.Duration(tick)*playerTickDuration, packetTypeID, []byte{byte(tick)})
+	}
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	return seeker
+}
+
+func playAll(t *testing.T, player *Player) ([]byte, time.Duration) {
+	var ticks []byte
+	start := time.Now()
+	playErr := player.Play(func(header InHeader, payload []byte) error {
+		if header.TypeIDString() == "pkt1" {
+			ticks = append(ticks, payload[0])
+		}
+		return nil
+	})
+	if playErr != nil {
+		t.Fatal(playErr)
+	}
+	return ticks, time.Since(start)
+}
+
+func TestPlayerPacing(t *testing.T) {
+	mediaDuration := (playerTickCount - 1) * playerTickDuration
+
+	player, _ := NewPlayer(newPlayerTestSeeker(t), PlayerOptions{})
+	ticks, elapsed := playAll(t, player)
+	if len(ticks) != playerTickCount || ticks[4] != 4 {
+		t.Errorf("wrong ticks %v", ticks)
+	}
+	if elapsed < mediaDuration {
+		t.Errorf("playback was too fast %v", elapsed)
+	}
+
+	fastPlayer, _ := NewPlayer(newPlayerTestSeeker(t), PlayerOptions{Speed: 100})
+	_, fastElapsed := playAll(t, fastPlayer)
+	if fastElapsed >= mediaDuration {
+		t.Errorf("playback at speed 100 was too slow %v", fastElapsed)
+	}
+}
+
+func TestPlayerSeekAndLoop(t *testing.T) {
+	player, _ := NewPlayer(newPlayerTestSeeker(t), PlayerOptions{Speed: 100, Loop: true})
+	seekErr := player.SeekTime(3 * playerTickDuration)
+	if seekErr != nil {
+		t.Fatal(seekErr)
+	}
+
+	chunks := make(chan PlayerChunk)
+	go player.PlayChannel(chunks)
+	var typeIDs []string
+	var timestamps []time.Duration
+	for chunk := range chunks {
+		typeIDs = append(typeIDs, chunk.Header.TypeIDString())
+		timestamps = append(timestamps, chunk.Timestamp)
+		if len(typeIDs) == 4 {
+			player.Stop()
+		}
+	}
+	expectedTypeIDs := []string{"pkt1", "pkt1", "sch1", "pkt1"}
+	for i, typeID := range expectedTypeIDs {
+		if i >= len(typeIDs) || typeIDs[i] != typeID {
+			t.Fatalf("wrong chunks after seek and loop %v", typeIDs)
+		}
+	}
+	if timestamps[0] != 3*playerTickDuration || timestamps[3] != 0 {
+		t.Errorf("wrong timestamps %v", timestamps)
+	}
+}
+
+func TestPlayerPauseResume(t *testing.T) {
+	const pauseDuration = 60 * time.Millisecond
+	player, _ := NewPlayer(newPlayerTestSeeker(t), PlayerOptions{Speed: 100})
+	var ticks []byte
+	start := time.Now()
+	playErr := player.Play(func(header InHeader, payload []byte) error {
+		if header.TypeIDString() != "pkt1" {
+			return nil
+		}
+		ticks = append(ticks, payload[0])
+		if payload[0] == 1 {
+			player.Pause()
+			time.AfterFunc(pauseDuration, player.Resume)
+		}
+		return nil
+	})
+	if playErr != nil {
+		t.Fatal(playErr)
+	}
+	if len(ticks) != playerTickCount {
+		t.Errorf("wrong ticks after resume %v", ticks)
+	}
+	if time.Since(start) < pauseDuration {
+		t.Errorf("pause did not hold playback")
+	}
+}
+
+// lockedReader lets the test check how far the player has read while it
+// plays in another goroutine.
+type lockedReader struct {
+	reader *bytes.Reader
+	mutex  sync.Mutex
+}
+
+func (r *lockedReader) Read(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.reader.Read(p)
+}
+
+func (r *lockedReader) Seek(offset int64, whence int) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.reader.Seek(offset, whence)
+}
+
+func (r *lockedReader) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.reader.Len()
+}
+
+func newPlayerTestStream(t *testing.T) (*InStream, *lockedReader) {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+	f.WriteChunkTypeIDString("sch1", []byte("schema"))
+	for tick := 0; tick < playerTickCount; tick++ {
+		f.WriteTimestampedChunk(time.Duration(tick)*playerTickDuration, packetTypeID, []byte{byte(tick)})
+	}
+	reader := &lockedReader{reader: bytes.NewReader(buf.Bytes())}
+	inStream, inErr := NewInStreamReadSeeker(reader)
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	return inStream, reader
+}
+
+func TestStreamPlayer(t *testing.T) {
+	mediaDuration := (playerTickCount - 1) * playerTickDuration
+	inStream, reader := newPlayerTestStream(t)
+	player, playerErr := NewStreamPlayer(inStream, PlayerOptions{})
+	if playerErr != nil {
+		t.Fatal(playerErr)
+	}
+	var unreadWhenFirstPlayed int
+	var timestamps []time.Duration
+	chunks := make(chan PlayerChunk)
+	start := time.Now()
+	go player.PlayChannel(chunks)
+	for chunk := range chunks {
+		if chunk.Header.TypeIDString() != "pkt1" {
+			continue
+		}
+		if len(timestamps) == 0 {
+			unreadWhenFirstPlayed = reader.Len()
+		}
+		timestamps = append(timestamps, chunk.Timestamp)
+	}
+	if len(timestamps) != playerTickCount || timestamps[4] != 4*playerTickDuration {
+		t.Errorf("wrong timestamps %v", timestamps)
+	}
+	if unreadWhenFirstPlayed == 0 {
+		t.Errorf("the stream should be read while playing, not before")
+	}
+	if time.Since(start) < mediaDuration {
+		t.Errorf("playback was too fast %v", time.Since(start))
+	}
+
+	if _, loopErr := NewStreamPlayer(inStream, PlayerOptions{Loop: true}); loopErr == nil {
+		t.Errorf("a stream player should not loop")
+	}
+	if seekErr := player.SeekTime(0); seekErr == nil {
+		t.Errorf("a stream player should not seek")
+	}
+}
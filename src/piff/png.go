@@ -0,0 +1,115 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// PNG chunks map one to one to piff chunks. The CRC is verified on import and
+// recalculated on export, so it is not stored in the piff file.
+
+func pngSignature() []byte {
+	return []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+}
+
+func pngChunkCRC(typeID []byte, payload []byte) uint32 {
+	crc := crc32.NewIEEE()
+	crc.Write(typeID)
+	crc.Write(payload)
+	return crc.Sum32()
+}
+
+func ImportPNG(reader io.Reader, outStream *OutStream) error {
+	octets, readErr := ioutil.ReadAll(reader)
+	if readErr != nil {
+		return readErr
+	}
+	signature := pngSignature()
+	if len(octets) < len(signature) || !bytes.Equal(octets[:len(signature)], signature) {
+		return fmt.Errorf("piff: png: not a valid png signature")
+	}
+
+	pos := int64(len(signature))
+	fileSize := int64(len(octets))
+	for pos < fileSize {
+		if fileSize-pos < 12 {
+			return fmt.Errorf("piff: png: partial chunk at %d", pos)
+		}
+		octetCount := int64(binary.BigEndian.Uint32(octets[pos : pos+4]))
+		typeIDOctets := octets[pos+4 : pos+8]
+		payloadStart := pos + 8
+		payloadEnd := payloadStart + octetCount
+		if payloadEnd+4 > fileSize {
+			return fmt.Errorf("piff: png: chunk '%v' at %d is truncated", string(typeIDOctets), pos)
+		}
+		payload := octets[payloadStart:payloadEnd]
+		storedCRC := binary.BigEndian.Uint32(octets[payloadEnd : payloadEnd+4])
+		if storedCRC != pngChunkCRC(typeIDOctets, payload) {
+			return fmt.Errorf("piff: png: chunk '%v' at %d has a bad crc", string(typeIDOctets), pos)
+		}
+		typeID, _ := NewTypeIDFromOctets(typeIDOctets)
+		if writeErr := outStream.WriteChunk(typeID, payload); writeErr != nil {
+			return writeErr
+		}
+		pos = payloadEnd + 4
+	}
+
+	return nil
+}
+
+func ExportPNG(inStream *InStream, writer io.Writer) error {
+	if _, writeErr := writer.Write(pngSignature()); writeErr != nil {
+		return writeErr
+	}
+	for {
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+		if int64(len(payload)) > math.MaxInt32 {
+			return fmt.Errorf("piff: png: chunk '%v' is too big", header.TypeIDString())
+		}
+		chunkOctets := make([]byte, 8+len(payload)+4)
+		binary.BigEndian.PutUint32(chunkOctets[0:4], uint32(len(payload)))
+		copy(chunkOctets[4:8], header.typeID[:])
+		copy(chunkOctets[8:], payload)
+		binary.BigEndian.PutUint32(chunkOctets[8+len(payload):], pngChunkCRC(header.typeID[:], payload))
+		if _, writeErr := writer.Write(chunkOctets); writeErr != nil {
+			return writeErr
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPNGRoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{R: 0xff, A: 0xff})
+	var original bytes.Buffer
+	encodeErr := png.Encode(&original, img)
+	if encodeErr != nil {
+		t.Fatal(encodeErr)
+	}
+
+	seeker := convertRoundTrip(t, original.Bytes(), ImportPNG, ExportPNG)
+	first, _, _ := seeker.FindChunk(0)
+	if first.TypeIDString() != "IHDR" {
+		t.Errorf("first chunk should be IHDR, was %v", first)
+	}
+	last, _, _ := seeker.FindChunk(seeker.ChunkCount() - 1)
+	if last.TypeIDString() != "IEND" {
+		t.Errorf("last chunk should be IEND, was %v", last)
+	}
+
+	corrupt := append([]byte{}, original.Bytes()...)
+	corrupt[20] ^= 0xff
+	var piffFile bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&piffFile)
+	if ImportPNG(bytes.NewReader(corrupt), outStream) == nil {
+		t.Errorf("expected crc error")
+	}
+}
@@ -0,0 +1,171 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"io"
+	"sync"
+)
+
+type prefetchedChunk struct {
+	header        InHeader
+	payload       []byte
+	err           error
+	pendingHeader InHeader
+	isEOF         bool
+}
+
+// readAhead reads chunks with its own InStream in a goroutine. Every chunk
+// carries the state the stream had after reading it, so the InStream that
+// hands out the chunks behaves exactly as if it had read them itself.
+type readAhead struct {
+	source             *InStream
+	chunks             chan prefetchedChunk
+	done               chan struct{}
+	finished           chan struct{}
+	closeOnce          sync.Once
+	mutex              sync.Mutex
+	octetsReleased     *sync.Cond
+	maxOctetCount      int64
+	bufferedOctetCount int64
+	isWaitingForOctets bool
+	isClosed           bool
+	lastErr            error
+}
+
+func newReadAhead(source *InStream, chunkCount int, maxOctetCount int64) *readAhead {
+	r := &readAhead{
+		source:        source,
+		chunks:        make(chan prefetchedChunk, chunkCount-1),
+		done:          make(chan struct{}),
+		finished:      make(chan struct{}),
+		maxOctetCount: maxOctetCount,
+	}
+	r.octetsReleased = sync.NewCond(&r.mutex)
+	go r.run()
+	return r
+}
+
+// reserve blocks while the buffered payloads would go over the octet limit.
+// A single chunk is always let through, even if it is larger than the limit.
+// isWaitingForOctets is broadcast on octetsReleased, so tests can wait for it.
+func (r *readAhead) reserve(octetCount int64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for r.maxOctetCount > 0 && !r.isClosed && r.bufferedOctetCount > 0 && r.bufferedOctetCount+octetCount > r.maxOctetCount {
+		r.isWaitingForOctets = true
+		r.octetsReleased.Broadcast()
+		r.octetsReleased.Wait()
+	}
+	r.isWaitingForOctets = false
+	r.bufferedOctetCount += octetCount
+	return !r.isClosed
+}
+
+func (r *readAhead) release(octetCount int64) {
+	r.mutex.Lock()
+	r.bufferedOctetCount -= octetCount
+	r.mutex.Unlock()
+	r.octetsReleased.Broadcast()
+}
+
+func (r *readAhead) run() {
+	defer close(r.finished)
+	defer close(r.chunks)
+	for {
+		header, payload, readErr := r.source.ReadChunk()
+		chunk := prefetchedChunk{header: header, payload: payload, err: readErr, pendingHeader: r.source.pendingHeader, isEOF: r.source.isEOF}
+		if !r.reserve(int64(len(payload))) {
+			return
+		}
+		select {
+		case r.chunks <- chunk:
+		case <-r.done:
+			return
+		}
+		if readErr != nil {
+			return
+		}
+	}
+}
+
+// next returns the same error again once the source has failed or ended.
+func (r *readAhead) next() prefetchedChunk {
+	if r.lastErr != nil {
+		return prefetchedChunk{err: r.lastErr, isEOF: r.lastErr == io.EOF}
+	}
+	chunk, isOpen := <-r.chunks
+	if !isOpen {
+		r.lastErr = io.ErrClosedPipe
+		return prefetchedChunk{err: r.lastErr}
+	}
+	r.release(int64(len(chunk.payload)))
+	if chunk.err != nil {
+		r.lastErr = chunk.err
+	}
+	return chunk
+}
+
+// close waits for the goroutine to stop, so the caller can use the reader
+// again when it returns. A read that is in progress is finished first.
+func (r *readAhead) close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.mutex.Lock()
+		r.isClosed = true
+		r.mutex.Unlock()
+		r.octetsReleased.Broadcast()
+	})
+	<-r.finished
+}
+
+func (c *InStream) startReadAhead() {
+	source := *c
+	c.readAhead = newReadAhead(&source, c.options.ReadAheadChunkCount, c.options.ReadAheadOctetCount)
+}
+
+func (c *InStream) nextPrefetchedChunk() prefetchedChunk {
+	chunk := c.readAhead.next()
+	if chunk.err == nil || chunk.err == io.EOF {
+		c.pendingHeader = chunk.pendingHeader
+		c.isEOF = chunk.isEOF || chunk.err == io.EOF
+	}
+	return chunk
+}
+
+func (c *InStream) readPrefetchedChunk(requestedOctetCount int) (InHeader, []byte, error) {
+	if c.readAhead.lastErr == nil && !c.isEOF {
+		if checkErr := checkRequestedOctetCount(c.pendingHeader, requestedOctetCount); checkErr != nil {
+			return InHeader{}, nil, checkErr
+		}
+	}
+	chunk := c.nextPrefetchedChunk()
+	if len(chunk.payload) > requestedOctetCount {
+		chunk.payload = chunk.payload[:requestedOctetCount]
+	}
+	return chunk.header, chunk.payload, chunk.err
+}
@@ -0,0 +1,252 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type readResult struct {
+	header  InHeader
+	payload []byte
+	err     string
+	isEOF   bool
+}
+
+// readMixed reads every third chunk partly and skips every fifth. The last
+// chunk is read, since a skipped truncated payload is reported differently
+// when it has already been read ahead.
+func readMixed(octets []byte, options InStreamOptions) ([]readResult, error) {
+	inStream, inErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(octets), options)
+	if inErr != nil {
+		return nil, inErr
+	}
+	defer inStream.Close()
+	var results []readResult
+	for i := 0; len(results) < 100; i++ {
+		var result readResult
+		var readErr error
+		switch {
+		case i%5 == 3:
+			result.header, readErr = inStream.SkipChunk()
+		case i%3 == 2:
+			result.header, result.payload, readErr = inStream.ReadPartChunk(4)
+		default:
+			result.header, result.payload, readErr = inStream.ReadChunk()
+		}
+		if readErr != nil {
+			result.err = readErr.Error()
+		}
+		result.isEOF = inStream.IsEOF()
+		results = append(results, result)
+		if readErr != nil {
+			break
+		}
+	}
+	return results, nil
+}
+
+func TestReadAhead(t *testing.T) {
+	octets := writeNumberedChunks(t, 20)
+	for name, input := range map[string][]byte{"complete": octets, "truncated": octets[:len(octets)-3]} {
+		expected, expectedErr := readMixed(input, InStreamOptions{})
+		if expectedErr != nil {
+			t.Fatal(expectedErr)
+		}
+		for _, options := range []InStreamOptions{
+			{ReadAheadChunkCount: 1},
+			{ReadAheadChunkCount: 4},
+			{ReadAheadChunkCount: 4, ReadAheadOctetCount: 10},
+		} {
+			results, readErr := readMixed(input, options)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if !reflect.DeepEqual(results, expected) {
+				t.Errorf("%v %+v: read ahead differs\n%v\n%v", name, options, results, expected)
+			}
+		}
+	}
+}
+
+func TestReadAheadErrorIsSticky(t *testing.T) {
+	octets := writeNumberedChunks(t, 3)
+	inStream, inErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(octets[:len(octets)-3]), InStreamOptions{ReadAheadChunkCount: 2})
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	defer inStream.Close()
+	var lastErr error
+	for i := 0; i < 5; i++ {
+		_, _, lastErr = inStream.ReadChunk()
+	}
+	if !errors.Is(lastErr, ErrTruncated) {
+		t.Errorf("expected truncated, got %v", lastErr)
+	}
+	if _, _, tooLongErr := inStream.ReadPartChunk(1000); !errors.Is(tooLongErr, ErrTruncated) {
+		t.Errorf("expected truncated, got %v", tooLongErr)
+	}
+}
+
+func TestReadAheadClose(t *testing.T) {
+	octets := writeNumberedChunks(t, 20)
+	inStream, inErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{ReadAheadChunkCount: 2})
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	if _, _, readErr := inStream.ReadChunk(); readErr != nil {
+		t.Fatal(readErr)
+	}
+	inStream.Close()
+	inStream.Close()
+	for i := 0; i < 20; i++ {
+		if _, _, readErr := inStream.ReadChunk(); readErr != nil {
+			if readErr != io.ErrClosedPipe {
+				t.Errorf("expected closed, got %v", readErr)
+			}
+			return
+		}
+	}
+	t.Errorf("reading should stop after close")
+}
+
+func TestReadAheadOctetCount(t *testing.T) {
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	for i := 0; i < 10; i++ {
+		outStream.WriteChunkTypeIDString("cafe", make([]byte, 100))
+	}
+	inStream, inErr := NewInStreamReadSeekerWithOptions(bytes.NewReader(buf.Bytes()), InStreamOptions{ReadAheadChunkCount: 8, ReadAheadOctetCount: 250})
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	defer inStream.Close()
+	r := inStream.readAhead
+	r.mutex.Lock()
+	for !r.isWaitingForOctets {
+		r.octetsReleased.Wait()
+	}
+	buffered := r.bufferedOctetCount
+	r.mutex.Unlock()
+	if buffered != 200 {
+		t.Errorf("expected 200 buffered octets, got %d", buffered)
+	}
+}
+
+// slowReadSeeker simulates a disk or network stream with latency per read.
+type slowReadSeeker struct {
+	*bytes.Reader
+	delay time.Duration
+}
+
+func (s *slowReadSeeker) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.Reader.Read(p)
+}
+
+func BenchmarkReadAhead(b *testing.B) {
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	payload := make([]byte, 4096)
+	for i := 0; i < 64; i++ {
+		outStream.WriteChunkTypeIDString("cafe", payload)
+	}
+	octets := buf.Bytes()
+
+	for _, delay := range []time.Duration{0, 20 * time.Microsecond} {
+		for _, chunkCount := range []int{0, 1, 8} {
+			name := "sync"
+			if chunkCount > 0 {
+				name = fmt.Sprintf("readahead%d", chunkCount)
+			}
+			b.Run(fmt.Sprintf("%v/delay%v", name, delay), func(b *testing.B) {
+				b.SetBytes(int64(len(octets)))
+				for n := 0; n < b.N; n++ {
+					reader := &slowReadSeeker{Reader: bytes.NewReader(octets), delay: delay}
+					inStream, inErr := NewInStreamReadSeekerWithOptions(reader, InStreamOptions{ReadAheadChunkCount: chunkCount})
+					if inErr != nil {
+						b.Fatal(inErr)
+					}
+					for !inStream.IsEOF() {
+						_, chunkPayload, readErr := inStream.ReadChunk()
+						if readErr != nil {
+							b.Fatal(readErr)
+						}
+						consume(chunkPayload, delay)
+					}
+					inStream.Close()
+				}
+			})
+		}
+	}
+}
+
+// consume stands in for the work a reader does per chunk.
+func consume(payload []byte, delay time.Duration) {
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func TestReadAheadCloseMidStream(t *testing.T) {
+	octets := writeNumberedChunks(t, 20)
+	// The slow reads keep the goroutine busy, so Close is likely called while
+	// a read is in progress.
+	reader := &slowReadSeeker{Reader: bytes.NewReader(octets), delay: time.Millisecond}
+	inStream, inErr := NewInStreamReadSeekerWithOptions(reader, InStreamOptions{ReadAheadChunkCount: 4})
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	if _, _, readErr := inStream.ReadChunk(); readErr != nil {
+		t.Fatal(readErr)
+	}
+	inStream.Close()
+
+	if _, seekErr := reader.Seek(0, io.SeekStart); seekErr != nil {
+		t.Fatal(seekErr)
+	}
+	again, againErr := NewInStreamReadSeeker(reader)
+	if againErr != nil {
+		t.Fatal(againErr)
+	}
+	chunkCount := 0
+	for !again.IsEOF() {
+		if _, _, readErr := again.ReadChunk(); readErr != nil {
+			t.Fatal(readErr)
+		}
+		chunkCount++
+	}
+	if chunkCount != 20 {
+		t.Errorf("the reader should be usable after Close, got %d chunks", chunkCount)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRefresh(t *testing.T) {
+	file, createErr := ioutil.TempFile("", "refresh")
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	cafe, _ := NewTypeIDFromString("cafe")
+	outStream.WriteTimestampedChunk(time.Second, cafe, []byte("first"))
+	file.Write(buf.Bytes())
+
+	reader, openErr := os.Open(file.Name())
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	defer reader.Close()
+	seeker, seekerErr := NewInSeekerWithOptions(reader, InStreamOptions{IgnoreSidecar: true})
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	if seeker.ChunkCount() != 2 {
+		t.Fatalf("wrong chunk count %d", seeker.ChunkCount())
+	}
+	if addedCount, refreshErr := seeker.Refresh(); addedCount != 0 || refreshErr != nil {
+		t.Errorf("nothing should be added, got %d %v", addedCount, refreshErr)
+	}
+
+	buf.Reset()
+	outStream.WriteTimestampedChunk(2*time.Second, cafe, []byte("second"))
+	outStream.WriteChunk(cafe, []byte("third"))
+	complete := buf.Len()
+	outStream.WriteChunk(cafe, []byte("fourth"))
+	file.Write(buf.Bytes()[:complete+5])
+
+	addedCount, refreshErr := seeker.Refresh()
+	if refreshErr != nil || addedCount != 3 {
+		t.Fatalf("expected three new chunks, got %d %v", addedCount, refreshErr)
+	}
+	_, last, _ := seeker.TimeSpan()
+	if last != 2*time.Second {
+		t.Errorf("wrong last timestamp %v", last)
+	}
+	header, payload, findErr := seeker.FindChunk(4)
+	if findErr != nil || header.ChunkIndex() != 4 || string(payload) != "third" {
+		t.Errorf("wrong chunk %v %q %v", header, payload, findErr)
+	}
+
+	file.Write(buf.Bytes()[complete+5:])
+	if addedCount, refreshErr := seeker.Refresh(); addedCount != 1 || refreshErr != nil {
+		t.Fatalf("the completed chunk should be added, got %d %v", addedCount, refreshErr)
+	}
+	if _, payload, _ := seeker.FindChunk(5); string(payload) != "fourth" {
+		t.Errorf("wrong payload %q", payload)
+	}
+}
+
+func TestRefreshPartialTail(t *testing.T) {
+	file, createErr := ioutil.TempFile("", "refresh")
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	fileHeaderSize := buf.Len()
+	outStream.WriteMetadata(map[string]string{"name": "partial"})
+	metadataEnd := buf.Len()
+	outStream.WriteChunkTypeIDString("cafe", []byte("some payload"))
+	octets := buf.Bytes()
+
+	file.Write(octets[:fileHeaderSize+5])
+	seeker, seekerErr := NewInSeekerFile(file.Name())
+	if seekerErr != nil {
+		t.Fatalf("a partial chunk header should not fail the open, got %v", seekerErr)
+	}
+	if metadata, metadataErr := seeker.Metadata(); metadata != nil || metadataErr != nil {
+		t.Errorf("there should be no metadata yet, got %v %v", metadata, metadataErr)
+	}
+
+	file.Write(octets[fileHeaderSize+5 : metadataEnd-2])
+	if addedCount, refreshErr := seeker.Refresh(); addedCount != 0 || refreshErr != nil {
+		t.Errorf("the partial metadata chunk should not be added, got %d %v", addedCount, refreshErr)
+	}
+
+	file.Write(octets[metadataEnd-2 : metadataEnd+3])
+	if addedCount, refreshErr := seeker.Refresh(); addedCount != 1 || refreshErr != nil {
+		t.Fatalf("the metadata chunk should be added, got %d %v", addedCount, refreshErr)
+	}
+	if metadata, metadataErr := seeker.Metadata(); metadataErr != nil || metadata["name"] != "partial" {
+		t.Errorf("wrong metadata %v %v", metadata, metadataErr)
+	}
+	if _, _, findErr := seeker.FindChunk(1); !errors.Is(findErr, ErrIndexOutOfRange) {
+		t.Errorf("the partial chunk should not be indexed, got %v", findErr)
+	}
+
+	file.Write(octets[metadataEnd+3:])
+	if addedCount, refreshErr := seeker.Refresh(); addedCount != 1 || refreshErr != nil {
+		t.Fatalf("the completed chunk should be added, got %d %v", addedCount, refreshErr)
+	}
+	if _, payload, _ := seeker.FindChunk(1); string(payload) != "some payload" {
+		t.Errorf("wrong payload %q", payload)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// RIFF and EA IFF files are a single group chunk ("RIFF", "FORM", ...) that
+// holds a form type followed by sub chunks. In piff the group chunk becomes a
+// first chunk with the group id as type id and the form type as payload,
+// followed by one piff chunk per sub chunk. Nested groups such as "LIST" are
+// kept as opaque payloads.
+
+type groupFormat struct {
+	name      string
+	byteOrder map[string]binary.ByteOrder
+}
+
+var riffFormat = groupFormat{
+	name: "riff",
+	byteOrder: map[string]binary.ByteOrder{
+		"RIFF": binary.LittleEndian,
+		"RIFX": binary.BigEndian,
+	},
+}
+
+var iffFormat = groupFormat{
+	name: "iff",
+	byteOrder: map[string]binary.ByteOrder{
+		"FORM": binary.BigEndian,
+		"LIST": binary.BigEndian,
+		"CAT ": binary.BigEndian,
+	},
+}
+
+func ImportRIFF(reader io.Reader, outStream *OutStream) error {
+	return importGroupFile(riffFormat, reader, outStream)
+}
+
+func ExportRIFF(inStream *InStream, writer io.Writer) error {
+	return exportGroupFile(riffFormat, inStream, writer)
+}
+
+func ImportIFF(reader io.Reader, outStream *OutStream) error {
+	return importGroupFile(iffFormat, reader, outStream)
+}
+
+func ExportIFF(inStream *InStream, writer io.Writer) error {
+	return exportGroupFile(iffFormat, inStream, writer)
+}
+
+func importGroupFile(format groupFormat, reader io.Reader, outStream *OutStream) error {
+	octets, readErr := ioutil.ReadAll(reader)
+	if readErr != nil {
+		return readErr
+	}
+	if len(octets) < 12 {
+		return fmt.Errorf("piff: %v: file is too short for a group chunk", format.name)
+	}
+	groupID := string(octets[0:4])
+	byteOrder, isKnownGroup := format.byteOrder[groupID]
+	if !isKnownGroup {
+		return fmt.Errorf("piff: %v: unknown group chunk '%v'", format.name, groupID)
+	}
+	groupOctetCount := int64(byteOrder.Uint32(octets[4:8]))
+	if groupOctetCount < 4 {
+		return fmt.Errorf("piff: %v: group chunk is too small (%d)", format.name, groupOctetCount)
+	}
+	groupEnd := 8 + groupOctetCount
+	if groupEnd != int64(len(octets)) {
+		return fmt.Errorf("piff: %v: group chunk ends at %d but file size is %d", format.name, groupEnd, len(octets))
+	}
+	if writeErr := outStream.WriteChunkTypeIDString(groupID, octets[8:12]); writeErr != nil {
+		return writeErr
+	}
+
+	pos := int64(12)
+	for pos < groupEnd {
+		if groupEnd-pos < 8 {
+			return fmt.Errorf("piff: %v: partial chunk header at %d", format.name, pos)
+		}
+		typeID, _ := NewTypeIDFromOctets(octets[pos : pos+4])
+		octetCount := int64(byteOrder.Uint32(octets[pos+4 : pos+8]))
+		payloadStart := pos + 8
+		payloadEnd := payloadStart + octetCount
+		if payloadEnd > groupEnd {
+			return fmt.Errorf("piff: %v: chunk '%v' at %d is truncated", format.name, string(typeID[:]), pos)
+		}
+		pos = payloadEnd
+		if octetCount%2 != 0 {
+			if pos >= groupEnd {
+				return fmt.Errorf("piff: %v: chunk '%v' is missing its pad octet", format.name, string(typeID[:]))
+			}
+			if octets[pos] != 0 {
+				return fmt.Errorf("piff: %v: chunk '%v' has a non zero pad octet", format.name, string(typeID[:]))
+			}
+			pos++
+		}
+		if writeErr := outStream.WriteChunk(typeID, octets[payloadStart:payloadEnd]); writeErr != nil {
+			return writeErr
+		}
+	}
+
+	return nil
+}
+
+func exportGroupFile(format groupFormat, inStream *InStream, writer io.Writer) error {
+	groupHeader, formType, groupErr := inStream.ReadChunk()
+	if groupErr != nil {
+		return groupErr
+	}
+	groupID := groupHeader.TypeIDString()
+	byteOrder, isKnownGroup := format.byteOrder[groupID]
+	if !isKnownGroup {
+		return fmt.Errorf("piff: %v: first chunk must be a group chunk, not '%v'", format.name, groupID)
+	}
+	if len(formType) != 4 {
+		return fmt.Errorf("piff: %v: form type must be four octets", format.name)
+	}
+
+	var body []byte
+	body = append(body, formType...)
+	for {
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+		if int64(len(payload)) > math.MaxUint32 {
+			return fmt.Errorf("piff: %v: chunk '%v' is too big", format.name, header.TypeIDString())
+		}
+		lengthOctets := make([]byte, 4)
+		byteOrder.PutUint32(lengthOctets, uint32(len(payload)))
+		body = append(body, header.typeID[:]...)
+		body = append(body, lengthOctets...)
+		body = append(body, payload...)
+		if len(payload)%2 != 0 {
+			body = append(body, 0)
+		}
+	}
+	if int64(len(body)) > math.MaxUint32 {
+		return fmt.Errorf("piff: %v: group chunk is too big", format.name)
+	}
+
+	groupOctets := make([]byte, 8)
+	copy(groupOctets, groupID)
+	byteOrder.PutUint32(groupOctets[4:], uint32(len(body)))
+	if _, writeErr := writer.Write(groupOctets); writeErr != nil {
+		return writeErr
+	}
+	_, writeErr := writer.Write(body)
+	return writeErr
+}
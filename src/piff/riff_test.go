@@ -0,0 +1,141 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+type importFunc func(io.Reader, *OutStream) error
+type exportFunc func(*InStream, io.Writer) error
+
+func buildGroupFile(byteOrder binary.ByteOrder, groupID string, formType string, chunks map[string][]byte, order []string) []byte {
+	var body bytes.Buffer
+	body.WriteString(formType)
+	for _, typeID := range order {
+		payload := chunks[typeID]
+		body.WriteString(typeID)
+		binary.Write(&body, byteOrder, uint32(len(payload)))
+		body.Write(payload)
+		if len(payload)%2 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	var file bytes.Buffer
+	file.WriteString(groupID)
+	binary.Write(&file, byteOrder, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+func convertRoundTrip(t *testing.T, original []byte, importer importFunc, exporter exportFunc) *InSeeker {
+	var piffFile bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&piffFile)
+	importErr := importer(bytes.NewReader(original), outStream)
+	if importErr != nil {
+		t.Fatal(importErr)
+	}
+
+	inStream, inErr := NewInStreamReadSeeker(bytes.NewReader(piffFile.Bytes()))
+	if inErr != nil {
+		t.Fatal(inErr)
+	}
+	var exported bytes.Buffer
+	exportErr := exporter(inStream, &exported)
+	if exportErr != nil {
+		t.Fatal(exportErr)
+	}
+	if !bytes.Equal(original, exported.Bytes()) {
+		t.Errorf("round trip is not identical\n%x\n%x", original, exported.Bytes())
+	}
+
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(piffFile.Bytes()))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	return seeker
+}
+
+func TestRIFFRoundTrip(t *testing.T) {
+	chunks := map[string][]byte{
+		"fmt ": {1, 0, 1, 0, 0x44, 0xac, 0, 0, 0x88, 0x58, 1, 0, 2, 0, 16, 0},
+		"LIST": []byte("INFOISFT\x05\x00\x00\x00piff\x00\x00"),
+		"data": {1, 2, 3},
+	}
+	order := []string{"fmt ", "LIST", "data"}
+	wav := buildGroupFile(binary.LittleEndian, "RIFF", "WAVE", chunks, order)
+	seeker := convertRoundTrip(t, wav, ImportRIFF, ExportRIFF)
+	if seeker.ChunkCount() != 4 {
+		t.Errorf("wrong chunk count %v", seeker.ChunkCount())
+	}
+	header, payload, _ := seeker.FindChunk(3)
+	if header.TypeIDString() != "data" || len(payload) != 3 {
+		t.Errorf("pad octet should not be part of the payload %v %v", header, payload)
+	}
+
+	rifx := buildGroupFile(binary.BigEndian, "RIFX", "WAVE", chunks, order)
+	convertRoundTrip(t, rifx, ImportRIFF, ExportRIFF)
+}
+
+func TestIFFRoundTrip(t *testing.T) {
+	chunks := map[string][]byte{
+		"BMHD": make([]byte, 20),
+		"CMAP": {0, 0, 0, 255, 255, 255},
+		"BODY": {0xaa, 0x55, 0x12},
+	}
+	ilbm := buildGroupFile(binary.BigEndian, "FORM", "ILBM", chunks, []string{"BMHD", "CMAP", "BODY"})
+	convertRoundTrip(t, ilbm, ImportIFF, ExportIFF)
+
+	var piffFile bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&piffFile)
+	if ImportRIFF(bytes.NewReader(ilbm), outStream) == nil {
+		t.Errorf("a FORM file is not a RIFF file")
+	}
+}
+
+func TestRIFFImportErrors(t *testing.T) {
+	wav := buildGroupFile(binary.LittleEndian, "RIFF", "WAVE", map[string][]byte{"data": {1, 2, 3}}, []string{"data"})
+	brokenFiles := [][]byte{
+		wav[:len(wav)-1],
+		append(append([]byte{}, wav...), 0),
+		wav[:10],
+	}
+	nonZeroPad := append([]byte{}, wav...)
+	nonZeroPad[len(nonZeroPad)-1] = 0xff
+	brokenFiles = append(brokenFiles, nonZeroPad)
+
+	for _, broken := range brokenFiles {
+		var piffFile bytes.Buffer
+		outStream, _ := NewOutStreamWriter(&piffFile)
+		if ImportRIFF(bytes.NewReader(broken), outStream) == nil {
+			t.Errorf("expected import error for %x", broken)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+type ChunkHandler func(header InHeader, payload []byte) error
+
+// ErrorHandler is called when a ChunkHandler fails. Returning nil continues
+// with the next chunk, returning an error stops the run with that error.
+type ErrorHandler func(header InHeader, err error) error
+
+// ErrStopRouting can be returned from a ChunkHandler to end a run early
+// without an error.
+var ErrStopRouting = errors.New("piff: stop routing")
+
+type RouterTypeStats struct {
+	ChunkCount   int
+	OctetCount   int64
+	HandledCount int
+	ErrorCount   int
+}
+
+func (s RouterTypeStats) String() string {
+	return fmt.Sprintf("[routerstats chunks:%v octets:%v handled:%v errors:%v]", s.ChunkCount, s.OctetCount, s.HandledCount, s.ErrorCount)
+}
+
+type Router struct {
+	handlers     map[TypeID]ChunkHandler
+	fallback     ChunkHandler
+	errorHandler ErrorHandler
+	stats        map[TypeID]*RouterTypeStats
+}
+
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[TypeID]ChunkHandler),
+		stats:    make(map[TypeID]*RouterTypeStats),
+	}
+}
+
+func (r *Router) Handle(typeID TypeID, handler ChunkHandler) {
+	r.handlers[typeID] = handler
+}
+
+func (r *Router) HandleUnknown(handler ChunkHandler) {
+	r.fallback = handler
+}
+
+func (r *Router) HandleError(handler ErrorHandler) {
+	r.errorHandler = handler
+}
+
+func (r *Router) Stats() map[TypeID]RouterTypeStats {
+	stats := make(map[TypeID]RouterTypeStats, len(r.stats))
+	for typeID, typeStats := range r.stats {
+		stats[typeID] = *typeStats
+	}
+	return stats
+}
+
+func (r *Router) ResetStats() {
+	r.stats = make(map[TypeID]*RouterTypeStats)
+}
+
+func (r *Router) handlerFor(typeID TypeID) ChunkHandler {
+	handler, wasFound := r.handlers[typeID]
+	if wasFound {
+		return handler
+	}
+	return r.fallback
+}
+
+func (r *Router) statsFor(header InHeader) *RouterTypeStats {
+	typeStats, wasFound := r.stats[header.typeID]
+	if !wasFound {
+		typeStats = &RouterTypeStats{}
+		r.stats[header.typeID] = typeStats
+	}
+	typeStats.ChunkCount++
+	typeStats.OctetCount += int64(header.OctetCount())
+	return typeStats
+}
+
+// dispatch returns io.EOF when the run should stop without an error.
+func (r *Router) dispatch(handler ChunkHandler, typeStats *RouterTypeStats, header InHeader, payload []byte) error {
+	typeStats.HandledCount++
+	handlerErr := handler(header, payload)
+	if handlerErr == nil {
+		return nil
+	}
+	if errors.Is(handlerErr, ErrStopRouting) {
+		return io.EOF
+	}
+	typeStats.ErrorCount++
+	if r.errorHandler == nil {
+		return handlerErr
+	}
+	return r.errorHandler(header, handlerErr)
+}
+
+func (r *Router) RunInStream(inStream *InStream) error {
+	for !inStream.IsEOF() {
+		pendingHeader := inStream.PendingChunkHeader()
+		handler := r.handlerFor(pendingHeader.typeID)
+		if handler == nil {
+			header, skipErr := inStream.SkipChunk()
+			if skipErr != nil {
+				return skipErr
+			}
+			r.statsFor(header)
+			continue
+		}
+		header, payload, readErr := inStream.ReadChunk()
+		if readErr != nil {
+			return readErr
+		}
+		dispatchErr := r.dispatch(handler, r.statsFor(header), header, payload)
+		if dispatchErr == io.EOF {
+			return nil
+		}
+		if dispatchErr != nil {
+			return dispatchErr
+		}
+	}
+	return nil
+}
+
+// RunInSeeker indexes the whole file first, so a lazy seeker that can not be
+// fully indexed fails before any handler is called.
+func (r *Router) RunInSeeker(seeker *InSeeker) error {
+	seekHeaders, indexErr := seeker.Headers()
+	if indexErr != nil {
+		return indexErr
+	}
+	for _, seekHeader := range seekHeaders {
+		header := seekHeader.Header()
+		handler := r.handlerFor(header.typeID)
+		typeStats := r.statsFor(header)
+		if handler == nil {
+			continue
+		}
+		_, payload, findErr := seeker.FindChunk(int(header.ChunkIndex()))
+		if findErr != nil {
+			return findErr
+		}
+		dispatchErr := r.dispatch(handler, typeStats, header, payload)
+		if dispatchErr == io.EOF {
+			return nil
+		}
+		if dispatchErr != nil {
+			return dispatchErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func writeRouterTestFile(t *testing.T) []byte {
+	chunks := []OutChunk{newTestChunk(t, "sch1", []byte("schema"))}
+	for i := 0; i < 5; i++ {
+		chunks = append(chunks, newTestChunk(t, "pkt1", []byte(fmt.Sprintf("packet %d", i))))
+	}
+	chunks = append(chunks, newTestChunk(t, "unkn", []byte("?")))
+	return writeTestFile(t, OutStreamOptions{}, chunks)
+}
+
+func TestRouterInStream(t *testing.T) {
+	schemaTypeID, _ := NewTypeIDFromString("sch1")
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+	unknownTypeID, _ := NewTypeIDFromString("unkn")
+
+	var schema string
+	var packets []string
+	router := NewRouter()
+	router.Handle(schemaTypeID, func(header InHeader, payload []byte) error {
+		schema = string(payload)
+		return nil
+	})
+	router.Handle(packetTypeID, func(header InHeader, payload []byte) error {
+		packets = append(packets, string(payload))
+		return nil
+	})
+
+	inStream, _ := NewInStreamReadSeeker(bytes.NewReader(writeRouterTestFile(t)))
+	runErr := router.RunInStream(inStream)
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	if schema != "schema" || len(packets) != 5 || packets[4] != "packet 4" {
+		t.Errorf("wrong routing %v %v", schema, packets)
+	}
+	stats := router.Stats()
+	if stats[packetTypeID].ChunkCount != 5 || stats[packetTypeID].OctetCount != 40 {
+		t.Errorf("wrong packet stats %v", stats[packetTypeID])
+	}
+	if stats[unknownTypeID].ChunkCount != 1 || stats[unknownTypeID].HandledCount != 0 {
+		t.Errorf("wrong unknown stats %v", stats[unknownTypeID])
+	}
+}
+
+func TestRouterInSeekerStopAndErrors(t *testing.T) {
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+
+	var unknownCount int
+	var failedIndices []ChunkIndex
+	router := NewRouter()
+	router.Handle(packetTypeID, func(header InHeader, payload []byte) error {
+		if header.ChunkIndex() == 4 {
+			return fmt.Errorf("done: %w", ErrStopRouting)
+		}
+		return fmt.Errorf("failed")
+	})
+	router.HandleUnknown(func(header InHeader, payload []byte) error {
+		unknownCount++
+		return nil
+	})
+	router.HandleError(func(header InHeader, err error) error {
+		failedIndices = append(failedIndices, header.ChunkIndex())
+		return nil
+	})
+
+	seeker, _ := NewInSeeker(bytes.NewReader(writeRouterTestFile(t)))
+	runErr := router.RunInSeeker(seeker)
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	if unknownCount != 1 {
+		t.Errorf("schema chunk should have gone to the fallback")
+	}
+	if len(failedIndices) != 3 || failedIndices[2] != 3 {
+		t.Errorf("wrong failed chunks %v", failedIndices)
+	}
+	if router.Stats()[packetTypeID].ErrorCount != 3 {
+		t.Errorf("wrong error count %v", router.Stats()[packetTypeID])
+	}
+}
+
+func TestRouterInSeekerIndexError(t *testing.T) {
+	octets := writeRouterTestFile(t)
+	seeker, seekerErr := NewInSeekerWithOptions(bytes.NewReader(octets), InStreamOptions{LazyIndex: true, MaxChunkCount: 4})
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	handledCount := 0
+	router := NewRouter()
+	router.HandleUnknown(func(header InHeader, payload []byte) error {
+		handledCount++
+		return nil
+	})
+	if runErr := router.RunInSeeker(seeker); !errors.Is(runErr, ErrLimitExceeded) {
+		t.Errorf("expected the index error, got %v", runErr)
+	}
+	if handledCount != 0 {
+		t.Errorf("no chunk should be handled when indexing fails, %d were", handledCount)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// shortReadSeeker returns at most maxOctetCount octets from every Read, like
+// pipes and network streams can. With returnEOFWithData it also returns
+// io.EOF together with the last octets.
+type shortReadSeeker struct {
+	reader            *bytes.Reader
+	random            *rand.Rand
+	maxOctetCount     int
+	returnEOFWithData bool
+}
+
+func (s *shortReadSeeker) Read(p []byte) (int, error) {
+	octetCount := s.maxOctetCount
+	if s.random != nil {
+		octetCount = 1 + s.random.Intn(s.maxOctetCount)
+	}
+	if len(p) > octetCount {
+		p = p[:octetCount]
+	}
+	n, err := s.reader.Read(p)
+	if err == nil && s.returnEOFWithData && s.reader.Len() == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *shortReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return s.reader.Seek(offset, whence)
+}
+
+func shortReadSeekers(octets []byte, seed int64) []io.ReadSeeker {
+	return []io.ReadSeeker{
+		&shortReadSeeker{reader: bytes.NewReader(octets), maxOctetCount: 1},
+		&shortReadSeeker{reader: bytes.NewReader(octets), maxOctetCount: 1, returnEOFWithData: true},
+		&shortReadSeeker{reader: bytes.NewReader(octets), maxOctetCount: 7, random: rand.New(rand.NewSource(seed))},
+	}
+}
+
+func readChunkPayloads(readSeeker io.ReadSeeker, skip bool) ([][]byte, error) {
+	inStream, inErr := NewInStreamReadSeeker(readSeeker)
+	if inErr != nil {
+		return nil, inErr
+	}
+	var payloads [][]byte
+	for !inStream.IsEOF() {
+		if skip {
+			if _, skipErr := inStream.SkipChunk(); skipErr != nil {
+				return payloads, skipErr
+			}
+			payloads = append(payloads, nil)
+			continue
+		}
+		_, payload, readErr := inStream.ReadChunk()
+		if readErr != nil {
+			return payloads, readErr
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+func TestShortReads(t *testing.T) {
+	var buf bytes.Buffer
+	outStream, _ := NewOutStreamWriter(&buf)
+	payloads := [][]byte{[]byte("first payload"), {}, bytes.Repeat([]byte{0xfe}, 300), []byte("last")}
+	chunkEnds := map[int]int{}
+	fileHeaderSize := len(fileFormatHeaderWithVersion(FileFormatVersion))
+	for i, payload := range payloads {
+		outStream.WriteChunkTypeIDString("shrt", payload)
+		chunkEnds[buf.Len()] = i + 1
+	}
+	octets := buf.Bytes()
+
+	for length := 0; length <= len(octets); length++ {
+		for readerIndex, readSeeker := range shortReadSeekers(octets[:length], int64(length)) {
+			for _, skip := range []bool{false, true} {
+				read, readErr := readChunkPayloads(readSeeker, skip)
+				readSeeker.Seek(0, io.SeekStart)
+				completeCount, isChunkEnd := chunkEnds[length]
+				switch {
+				case length < fileHeaderSize:
+					if readErr == nil {
+						t.Fatalf("length %d reader %d: expected error for partial file header", length, readerIndex)
+					}
+				case length == fileHeaderSize || isChunkEnd:
+					if readErr != nil || len(read) != completeCount {
+						t.Fatalf("length %d reader %d skip %v: expected %d chunks, got %d %v", length, readerIndex, skip, completeCount, len(read), readErr)
+					}
+					for i := range read {
+						if !skip && !bytes.Equal(read[i], payloads[i]) {
+							t.Fatalf("length %d reader %d: chunk %d differs", length, readerIndex, i)
+						}
+					}
+				default:
+					if !errors.Is(readErr, ErrTruncated) {
+						t.Fatalf("length %d reader %d skip %v: expected truncated, got %v", length, readerIndex, skip, readErr)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/piot/brook-go/src/instream"
+	"github.com/piot/brook-go/src/outstream"
+)
+
+// A sidecar index is a piff file next to the source file, named
+// SidecarFilename(source). It holds a single index chunk with the size and
+// modification time of the source file, followed by the position, type id,
+// octet count, flags and timestamp of every chunk. A sidecar is only used
+// when the size and modification time still match the source file.
+var SidecarIndexTypeID = TypeID{'i', 'd', 'x', '1'}
+
+const SidecarExtension = ".piffidx"
+
+const sidecarEntryOctetCount = 4 + 8 + 4 + 1 + 8
+
+const (
+	sidecarFlagHasTimestamp uint8 = 1 << iota
+	sidecarFlagBadTimestamp
+)
+
+func SidecarFilename(filename string) string {
+	return filename + SidecarExtension
+}
+
+type sidecarIndex struct {
+	sourceOctetCount int64
+	sourceModTime    int64
+	seekHeaders      []InSeekHeader
+}
+
+func sidecarIndexToOctets(index sidecarIndex) []byte {
+	s := outstream.New()
+	s.WriteUint64(uint64(index.sourceOctetCount))
+	s.WriteUint64(uint64(index.sourceModTime))
+	s.WriteUint32(uint32(len(index.seekHeaders)))
+	for _, seekHeader := range index.seekHeaders {
+		header := seekHeader.header
+		s.WriteOctets(header.typeID[:])
+		s.WriteUint64(uint64(header.tell))
+		s.WriteUint32(uint32(header.octetLength))
+		flags := uint8(0)
+		if seekHeader.hasTimestamp {
+			flags |= sidecarFlagHasTimestamp
+		}
+		if seekHeader.timestampErr != nil {
+			flags |= sidecarFlagBadTimestamp
+		}
+		s.WriteUint8(flags)
+		s.WriteUint64(uint64(seekHeader.timestamp))
+	}
+	return s.Octets()
+}
+
+func sidecarIndexFromOctets(payload []byte) (sidecarIndex, error) {
+	if len(payload) < 8+8+4 {
+		return sidecarIndex{}, fmt.Errorf("piff: sidecar index is too short")
+	}
+	s := instream.New(payload)
+	sourceOctetCount, _ := s.ReadUint64()
+	sourceModTime, _ := s.ReadUint64()
+	chunkCount, _ := s.ReadUint32()
+	if int64(len(payload)-8-8-4) != int64(chunkCount)*sidecarEntryOctetCount {
+		return sidecarIndex{}, fmt.Errorf("piff: sidecar index has %d octets for %d chunks", len(payload), chunkCount)
+	}
+	index := sidecarIndex{sourceOctetCount: int64(sourceOctetCount), sourceModTime: int64(sourceModTime)}
+	index.seekHeaders = make([]InSeekHeader, chunkCount)
+	for i := range index.seekHeaders {
+		typeIDOctets, _ := s.ReadOctets(4)
+		typeID, _ := NewTypeIDFromOctets(typeIDOctets)
+		tell, _ := s.ReadUint64()
+		octetCount, _ := s.ReadUint32()
+		flags, _ := s.ReadUint8()
+		timestamp, _ := s.ReadUint64()
+		header := InHeader{typeID: typeID, octetLength: int(octetCount), tell: int64(tell), chunkIndex: ChunkIndex(i)}
+		seekHeader := InSeekHeader{header: header, timestamp: time.Duration(timestamp), hasTimestamp: flags&sidecarFlagHasTimestamp != 0}
+		if flags&sidecarFlagBadTimestamp != 0 {
+			seekHeader.timestampErr = newChunkError(ErrInvalidTimestamp, header, "marked as unusable in the sidecar index")
+		}
+		index.seekHeaders[i] = seekHeader
+	}
+	return index, nil
+}
+
+func readSidecarIndex(filename string) (sidecarIndex, error) {
+	sidecarFile, openErr := os.Open(SidecarFilename(filename))
+	if openErr != nil {
+		return sidecarIndex{}, openErr
+	}
+	defer sidecarFile.Close()
+	inStream, inErr := NewInStreamReadSeekerWithOptions(sidecarFile, InStreamOptions{Format: FileFormatPiff, AllowedTypeIDs: []TypeID{SidecarIndexTypeID}})
+	if inErr != nil {
+		return sidecarIndex{}, inErr
+	}
+	_, payload, readErr := inStream.ReadChunk()
+	if readErr != nil {
+		return sidecarIndex{}, readErr
+	}
+	return sidecarIndexFromOctets(payload)
+}
+
+func readFreshSidecarIndex(filename string) (sidecarIndex, bool) {
+	index, indexErr := readSidecarIndex(filename)
+	if indexErr != nil {
+		return sidecarIndex{}, false
+	}
+	info, statErr := os.Stat(filename)
+	isFresh := statErr == nil && index.sourceOctetCount == info.Size() && index.sourceModTime == info.ModTime().UnixNano()
+	return index, isFresh
+}
+
+// IsSidecarFresh tells if the sidecar of filename exists and still matches it.
+func IsSidecarFresh(filename string) bool {
+	_, isFresh := readFreshSidecarIndex(filename)
+	return isFresh
+}
+
+// useSidecar replaces the scan when the stream is a file with a fresh
+// sidecar. Sidecar chunks are still checked against the limits.
+func (c *InSeeker) useSidecar() bool {
+	file, isFile := c.inFile.inStream.(*os.File)
+	if !isFile || c.inFile.options.IgnoreSidecar {
+		return false
+	}
+	index, isFresh := readFreshSidecarIndex(file.Name())
+	if !isFresh {
+		return false
+	}
+	tell := c.inFile.firstChunkTell
+	for _, seekHeader := range index.seekHeaders {
+		if seekHeader.header.tell != tell || c.inFile.checkLimits(seekHeader.header) != nil {
+			return false
+		}
+		tell += chunkHeaderOctetCount + int64(seekHeader.header.octetLength)
+	}
+	if tell != index.sourceOctetCount {
+		return false
+	}
+	for _, seekHeader := range index.seekHeaders {
+		c.addSeekHeader(seekHeader)
+		c.currentTimestamp = seekHeader.timestamp
+		c.hasTimestamp = seekHeader.hasTimestamp
+	}
+	c.fromSidecar = true
+	c.isFullyIndexed = true
+	return true
+}
+
+// WriteSidecar writes the sidecar index for the file the seeker reads.
+func (c *InSeeker) WriteSidecar() error {
+	file, isFile := c.inFile.inStream.(*os.File)
+	if !isFile {
+		return fmt.Errorf("piff: sidecars can only be written for files")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if indexErr := c.indexAll(); indexErr != nil {
+		return indexErr
+	}
+	info, statErr := file.Stat()
+	if statErr != nil {
+		return statErr
+	}
+	indexedOctetCount := c.indexedEnd()
+	if indexedOctetCount != info.Size() {
+		return fmt.Errorf("piff: '%v' is %d octets, but the index covers %d octets", file.Name(), info.Size(), indexedOctetCount)
+	}
+
+	index := sidecarIndex{sourceOctetCount: info.Size(), sourceModTime: info.ModTime().UnixNano(), seekHeaders: c.seekHeaders}
+	outStream, outErr := NewOutStream(SidecarFilename(file.Name()))
+	if outErr != nil {
+		return outErr
+	}
+	writeErr := outStream.WriteChunk(SidecarIndexTypeID, sidecarIndexToOctets(index))
+	closeErr := outStream.Close()
+	if writeErr != nil {
+		return writeErr
+	}
+	return closeErr
+}
+
+// BuildSidecar scans filename and writes its sidecar index, replacing any
+// earlier sidecar.
+func BuildSidecar(filename string) error {
+	file, openErr := os.Open(filename)
+	if openErr != nil {
+		return openErr
+	}
+	defer file.Close()
+	seeker, seekerErr := NewInSeekerWithOptions(file, InStreamOptions{IgnoreSidecar: true})
+	if seekerErr != nil {
+		return seekerErr
+	}
+	return seeker.WriteSidecar()
+}
@@ -0,0 +1,125 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSidecar(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "piffidx")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "some.piff")
+	outStream, outErr := NewOutStream(filename)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	var chunks []OutChunk
+	for i := 0; i < 5; i++ {
+		if i%2 == 0 {
+			chunks = append(chunks, OutChunk{TypeID: TimestampTypeID, Payload: timestampToOctets(time.Duration(i/2) * time.Second)})
+		}
+		chunks = append(chunks, newTestChunk(t, "cafe", []byte("some payload")))
+	}
+	writeTestStream(t, outStream, chunks)
+
+	if IsSidecarFresh(filename) {
+		t.Errorf("there should be no sidecar yet")
+	}
+	if buildErr := BuildSidecar(filename); buildErr != nil {
+		t.Fatal(buildErr)
+	}
+	if !IsSidecarFresh(filename) {
+		t.Fatalf("sidecar should be fresh")
+	}
+
+	scanned, _ := NewInSeekerWithOptions(mustOpen(t, filename), InStreamOptions{IgnoreSidecar: true})
+	indexed, indexedErr := NewInSeekerFile(filename)
+	if indexedErr != nil {
+		t.Fatal(indexedErr)
+	}
+	if !indexed.fromSidecar || scanned.fromSidecar {
+		t.Fatalf("only the second seeker should use the sidecar")
+	}
+	if len(indexed.AllHeaders()) != len(scanned.AllHeaders()) {
+		t.Fatalf("wrong chunk count %d", indexed.ChunkCount())
+	}
+	for i, seekHeader := range scanned.AllHeaders() {
+		if indexed.AllHeaders()[i] != seekHeader {
+			t.Errorf("chunk %d differs: %v %v", i, indexed.AllHeaders()[i], seekHeader)
+		}
+	}
+	index, _ := indexed.ChunkIndexAtTime(time.Second)
+	if _, payload, _ := indexed.FindChunk(index + 1); string(payload) != "some payload" {
+		t.Errorf("wrong payload %q", payload)
+	}
+
+	limited, _ := NewInSeekerWithOptions(mustOpen(t, filename), InStreamOptions{MaxChunkCount: 2})
+	if limited != nil {
+		t.Errorf("limits should apply to sidecar indexes too")
+	}
+
+	appended, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	appended.Write([]byte("cafe\x00\x00\x00\x00"))
+	appended.Close()
+	if IsSidecarFresh(filename) {
+		t.Errorf("sidecar should be stale after the file changed")
+	}
+	stale, _ := NewInSeekerFile(filename)
+	if stale.fromSidecar || stale.ChunkCount() != len(scanned.AllHeaders())+1 {
+		t.Errorf("stale sidecar should not be used")
+	}
+}
+
+func mustOpen(t *testing.T, filename string) *os.File {
+	file, openErr := os.Open(filename)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	return file
+}
+
+func TestSidecarBadTimestamp(t *testing.T) {
+	header := InHeader{typeID: TimestampTypeID, octetLength: 3, tell: 10}
+	index := sidecarIndex{seekHeaders: []InSeekHeader{{header: header, timestampErr: ErrInvalidTimestamp}}}
+	readIndex, readErr := sidecarIndexFromOctets(sidecarIndexToOctets(index))
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	seekHeader := readIndex.seekHeaders[0]
+	if seekHeader.hasTimestamp || !errors.Is(seekHeader.TimestampErr(), ErrInvalidTimestamp) {
+		t.Errorf("the bad timestamp should be kept in the sidecar, got %v", seekHeader)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/piot/brook-go/src/instream"
+	"github.com/piot/brook-go/src/outstream"
+)
+
+// A timestamp chunk holds the time since the start of the recording as an
+// unsigned 64 bit nanosecond count. It applies to itself and to every chunk
+// after it, up to the next timestamp chunk.
+var TimestampTypeID = TypeID{'t', 'i', 'm', '1'}
+
+func timestampToOctets(timestamp time.Duration) []byte {
+	s := outstream.New()
+	s.WriteUint64(uint64(timestamp))
+	return s.Octets()
+}
+
+func TimestampFromOctets(payload []byte) (time.Duration, error) {
+	if len(payload) != 8 {
+		return 0, fmt.Errorf("%w: timestamp chunk must be exactly eight octets, was %d", ErrInvalidTimestamp, len(payload))
+	}
+	s := instream.New(payload)
+	nanoseconds, readErr := s.ReadUint64()
+	if readErr != nil {
+		return 0, readErr
+	}
+	if nanoseconds > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %d nanoseconds does not fit in a time.Duration", ErrInvalidTimestamp, nanoseconds)
+	}
+	return time.Duration(nanoseconds), nil
+}
@@ -0,0 +1,134 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+	f.WriteChunkTypeIDString("sch1", []byte("schema"))
+	for tick := 0; tick < 10; tick++ {
+		timestamp := time.Duration(tick) * 50 * time.Millisecond
+		f.WriteTimestampedChunk(timestamp, packetTypeID, []byte{byte(tick)})
+		f.WriteTimestampedChunk(timestamp, packetTypeID, []byte{byte(tick), 1})
+	}
+	if f.WriteTimestamp(10*time.Millisecond) == nil {
+		t.Errorf("timestamps must not go backwards")
+	}
+
+	i, err := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestampCount, _ := i.Count(TimestampTypeID); timestampCount != 10 {
+		t.Errorf("same tick should share a timestamp chunk, got %d", timestampCount)
+	}
+	start, end, spanErr := i.TimeSpan()
+	if spanErr != nil || start != 0 || end != 450*time.Millisecond {
+		t.Errorf("wrong time span %v %v %v", start, end, spanErr)
+	}
+	if _, hasTimestamp := i.AllHeaders()[0].Timestamp(); hasTimestamp {
+		t.Errorf("chunk before the first timestamp should not have one")
+	}
+
+	index, findErr := i.ChunkIndexAtTime(220 * time.Millisecond)
+	if findErr != nil {
+		t.Fatal(findErr)
+	}
+	if index != 1+4*3 {
+		t.Errorf("wrong chunk index %d", index)
+	}
+	header, payload, _ := i.FindChunk(index + 1)
+	timestamp, _ := i.AllHeaders()[index+1].Timestamp()
+	if header.TypeIDString() != "pkt1" || payload[0] != 4 || timestamp != 200*time.Millisecond {
+		t.Errorf("wrong chunk at time %v %v %v", header, payload, timestamp)
+	}
+	if first, _ := i.ChunkIndexAtTime(-time.Second); first != 1 {
+		t.Errorf("time before the start should give the first timestamp")
+	}
+}
+
+func TestTimestampOverflow(t *testing.T) {
+	payload := []byte{0x80, 0, 0, 0, 0, 0, 0, 1}
+	if _, timestampErr := TimestampFromOctets(payload); !errors.Is(timestampErr, ErrInvalidTimestamp) {
+		t.Errorf("expected invalid timestamp, got %v", timestampErr)
+	}
+}
+
+func TestBadTimestampsAreSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	f.WriteChunkTypeIDString("cafe", []byte("before"))
+	f.WriteChunk(TimestampTypeID, []byte{1, 2, 3})
+	f.WriteTimestamp(2 * time.Second)
+	f.WriteChunkTypeIDString("cafe", []byte("two"))
+	f.WriteChunk(TimestampTypeID, timestampToOctets(time.Second))
+	f.WriteChunkTypeIDString("cafe", []byte("still two"))
+	f.WriteChunk(TimestampTypeID, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.WriteTimestamp(3 * time.Second)
+	f.WriteChunkTypeIDString("cafe", []byte("three"))
+
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	headers := seeker.AllHeaders()
+	if len(headers) != 9 {
+		t.Fatalf("every chunk should be indexed, got %d", len(headers))
+	}
+	expectedErrs := map[int]error{1: ErrInvalidTimestamp, 4: ErrTimestampOrder, 6: ErrInvalidTimestamp}
+	for i, seekHeader := range headers {
+		timestampErr := seekHeader.TimestampErr()
+		if !errors.Is(timestampErr, expectedErrs[i]) || (expectedErrs[i] == nil) != (timestampErr == nil) {
+			t.Errorf("chunk %d: expected %v, got %v", i, expectedErrs[i], timestampErr)
+		}
+		var chunkErr *ChunkError
+		if timestampErr != nil && (!errors.As(timestampErr, &chunkErr) || chunkErr.ChunkIndex != ChunkIndex(i)) {
+			t.Errorf("chunk %d: expected a chunk error, got %v", i, timestampErr)
+		}
+	}
+	if _, hasTimestamp := headers[1].Timestamp(); hasTimestamp {
+		t.Errorf("a bad first timestamp should leave the chunk untimed")
+	}
+	if timestamp, _ := headers[5].Timestamp(); timestamp != 2*time.Second {
+		t.Errorf("an out of order timestamp should be ignored, got %v", timestamp)
+	}
+	start, end, spanErr := seeker.TimeSpan()
+	if spanErr != nil || start != 2*time.Second || end != 3*time.Second {
+		t.Errorf("wrong time span %v %v %v", start, end, spanErr)
+	}
+	if index, _ := seeker.ChunkIndexAtTime(2500 * time.Millisecond); index != 2 {
+		t.Errorf("bad timestamps should not be used for seeking, got chunk %d", index)
+	}
+}
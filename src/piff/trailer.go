@@ -0,0 +1,173 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/piot/brook-go/src/instream"
+	"github.com/piot/brook-go/src/outstream"
+)
+
+// The trailer is an optional last chunk that holds the payload octet count of
+// every chunk before it, so the chunks can be found from the end of the file
+// without scanning it. The payload is an uint32 octet count per chunk,
+// followed by the chunk count and the trailer type id again, so the trailer
+// can be found from the last eight octets of the file.
+var TrailerTypeID = TypeID{'t', 'r', 'l', '1'}
+
+const trailerFooterOctetCount = 8
+
+func trailerToOctets(octetCounts []uint32) []byte {
+	s := outstream.New()
+	for _, octetCount := range octetCounts {
+		s.WriteUint32(octetCount)
+	}
+	s.WriteUint32(uint32(len(octetCounts)))
+	s.WriteOctets(TrailerTypeID[:])
+	return s.Octets()
+}
+
+// ReverseIterator returns the chunks from the last to the first, using the
+// trailer. The trailer chunk itself is not returned.
+type ReverseIterator struct {
+	inStream *InStream
+	headers  []InHeader
+	next     int
+}
+
+func readTrailerOctetCounts(readSeeker io.ReadSeeker, firstChunkTell int64) ([]uint32, int64, error) {
+	end, endErr := readSeeker.Seek(0, io.SeekEnd)
+	if endErr != nil {
+		return nil, 0, endErr
+	}
+	if end-firstChunkTell < chunkHeaderOctetCount+trailerFooterOctetCount {
+		return nil, 0, ErrNoTrailer
+	}
+	if _, seekErr := readSeeker.Seek(end-trailerFooterOctetCount, io.SeekStart); seekErr != nil {
+		return nil, 0, seekErr
+	}
+	footer := make([]byte, trailerFooterOctetCount)
+	if _, readErr := io.ReadFull(readSeeker, footer); readErr != nil {
+		return nil, 0, readErr
+	}
+	if !TrailerTypeID.IsEqual([4]byte{footer[4], footer[5], footer[6], footer[7]}) {
+		return nil, 0, ErrNoTrailer
+	}
+
+	chunkCount := int64(binary.BigEndian.Uint32(footer[0:4]))
+	payloadOctetCount := chunkCount*4 + trailerFooterOctetCount
+	trailerTell := end - chunkHeaderOctetCount - payloadOctetCount
+	if trailerTell < firstChunkTell {
+		return nil, 0, &ChunkError{Err: ErrBadTrailer, ChunkIndex: ChunkIndex(chunkCount), Offset: end - trailerFooterOctetCount, TypeID: TrailerTypeID, Message: fmt.Sprintf("%d chunks do not fit in the file", chunkCount)}
+	}
+	if _, seekErr := readSeeker.Seek(trailerTell, io.SeekStart); seekErr != nil {
+		return nil, 0, seekErr
+	}
+	chunk, _, readErr := readPayload(readSeeker, chunkHeaderOctetCount+int(payloadOctetCount))
+	if readErr != nil {
+		return nil, 0, readErr
+	}
+	s := instream.New(chunk)
+	typeID, _ := s.ReadOctets(4)
+	trailerOctetCount, _ := s.ReadUint32()
+	if !TrailerTypeID.IsEqual([4]byte{typeID[0], typeID[1], typeID[2], typeID[3]}) || int64(trailerOctetCount) != payloadOctetCount {
+		return nil, 0, &ChunkError{Err: ErrBadTrailer, ChunkIndex: ChunkIndex(chunkCount), Offset: trailerTell, TypeID: TrailerTypeID, Message: "no trailer chunk header"}
+	}
+	octetCounts := make([]uint32, chunkCount)
+	for i := range octetCounts {
+		octetCounts[i], _ = s.ReadUint32()
+	}
+	return octetCounts, trailerTell, nil
+}
+
+func NewReverseIterator(readSeeker io.ReadSeeker) (*ReverseIterator, error) {
+	return NewReverseIteratorWithFormat(readSeeker, FileFormatAuto)
+}
+
+// NewReverseIteratorWithFormat skips the format detection like
+// InStreamOptions.Format.
+func NewReverseIteratorWithFormat(readSeeker io.ReadSeeker, format FileFormat) (*ReverseIterator, error) {
+	if _, formatErr := readFileFormat(readSeeker, format); formatErr != nil {
+		return nil, formatErr
+	}
+	firstChunkTell, tellErr := readSeeker.Seek(0, io.SeekCurrent)
+	if tellErr != nil {
+		return nil, tellErr
+	}
+	octetCounts, trailerTell, trailerErr := readTrailerOctetCounts(readSeeker, firstChunkTell)
+	if trailerErr != nil {
+		return nil, trailerErr
+	}
+
+	headers := make([]InHeader, len(octetCounts))
+	tell := firstChunkTell
+	for i, octetCount := range octetCounts {
+		headers[i] = InHeader{octetLength: int(octetCount), tell: tell, chunkIndex: ChunkIndex(i)}
+		tell += chunkHeaderOctetCount + int64(octetCount)
+	}
+	if tell != trailerTell {
+		return nil, &ChunkError{Err: ErrBadTrailer, ChunkIndex: ChunkIndex(len(headers)), Offset: trailerTell, TypeID: TrailerTypeID, Message: fmt.Sprintf("the chunks end at %d, but the trailer starts at %d", tell, trailerTell)}
+	}
+
+	return &ReverseIterator{inStream: &InStream{inStream: readSeeker}, headers: headers, next: len(headers) - 1}, nil
+}
+
+// ChunkCount does not count the trailer chunk.
+func (c *ReverseIterator) ChunkCount() int {
+	return len(c.headers)
+}
+
+// Next returns io.EOF when the first chunk has been returned.
+func (c *ReverseIterator) Next() (InHeader, []byte, error) {
+	if c.next < 0 {
+		return InHeader{}, nil, io.EOF
+	}
+	expected := c.headers[c.next]
+	if _, seekErr := c.inStream.inStream.Seek(expected.tell, io.SeekStart); seekErr != nil {
+		return InHeader{}, nil, seekErr
+	}
+	c.inStream.chunkIndex = expected.chunkIndex
+	header, headerErr := c.inStream.readHeaderInternal()
+	if headerErr == io.EOF {
+		return InHeader{}, nil, newChunkError(ErrTruncated, expected, "chunk header is missing")
+	}
+	if headerErr != nil {
+		return InHeader{}, nil, headerErr
+	}
+	if header.octetLength != expected.octetLength {
+		return InHeader{}, nil, newChunkError(ErrBadTrailer, header, "the trailer says %d octets", expected.octetLength)
+	}
+	payload, payloadErr := c.inStream.internalRead(header, header.octetLength)
+	if payloadErr != nil {
+		return InHeader{}, nil, payloadErr
+	}
+	c.next--
+	return header, payload, nil
+}
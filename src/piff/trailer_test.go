@@ -0,0 +1,116 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestReverseIterator(t *testing.T) {
+	octets := writeTestFile(t, OutStreamOptions{Trailer: true}, numberedTestChunks(t, 12))
+	iterator, iteratorErr := NewReverseIterator(bytes.NewReader(octets))
+	if iteratorErr != nil {
+		t.Fatal(iteratorErr)
+	}
+	if iterator.ChunkCount() != 12 {
+		t.Errorf("wrong chunk count %d", iterator.ChunkCount())
+	}
+	for i := 11; i >= 0; i-- {
+		header, payload, nextErr := iterator.Next()
+		if nextErr != nil {
+			t.Fatal(nextErr)
+		}
+		if header.ChunkIndex() != ChunkIndex(i) || string(payload) != fmt.Sprintf("chunk %d", i) {
+			t.Errorf("wrong chunk %v %q", header, payload)
+		}
+	}
+	if _, _, endErr := iterator.Next(); endErr != io.EOF {
+		t.Errorf("expected EOF, got %v", endErr)
+	}
+
+	seeker, _ := NewInSeeker(bytes.NewReader(octets))
+	if trailerCount, _ := seeker.Count(TrailerTypeID); seeker.ChunkCount() != 13 || trailerCount != 1 {
+		t.Errorf("the trailer should be a normal last chunk for forward readers")
+	}
+
+	empty, emptyErr := NewReverseIterator(bytes.NewReader(writeTestFile(t, OutStreamOptions{Trailer: true}, numberedTestChunks(t, 0))))
+	if emptyErr != nil || empty.ChunkCount() != 0 {
+		t.Errorf("expected empty iterator, got %v", emptyErr)
+	}
+}
+
+func TestReverseIteratorWithFormat(t *testing.T) {
+	octets := writeTestFile(t, OutStreamOptions{Trailer: true}, numberedTestChunks(t, 2))
+	if _, formatErr := NewReverseIteratorWithFormat(bytes.NewReader(octets), FileFormatPiff); formatErr != nil {
+		t.Fatal(formatErr)
+	}
+	fileHeaderSize := len(fileFormatHeaderWithVersion(FileFormatVersion))
+	headerless := octets[fileHeaderSize:]
+	iterator, iteratorErr := NewReverseIteratorWithFormat(bytes.NewReader(headerless), FileFormatHeaderless)
+	if iteratorErr != nil {
+		t.Fatal(iteratorErr)
+	}
+	if iterator.ChunkCount() != 2 {
+		t.Errorf("wrong chunk count %d", iterator.ChunkCount())
+	}
+	if _, piffErr := NewReverseIteratorWithFormat(bytes.NewReader(headerless), FileFormatPiff); !errors.Is(piffErr, ErrBadMagic) {
+		t.Errorf("expected bad magic, got %v", piffErr)
+	}
+}
+
+func TestReverseIteratorErrors(t *testing.T) {
+	if _, noTrailerErr := NewReverseIterator(bytes.NewReader(writeTestChunks(t, 3))); !errors.Is(noTrailerErr, ErrNoTrailer) {
+		t.Errorf("expected no trailer, got %v", noTrailerErr)
+	}
+
+	octets := writeTestFile(t, OutStreamOptions{Trailer: true}, numberedTestChunks(t, 3))
+	wrongCount := append([]byte{}, octets...)
+	wrongCount[len(wrongCount)-9]++
+	if _, countErr := NewReverseIterator(bytes.NewReader(wrongCount)); !errors.Is(countErr, ErrBadTrailer) {
+		t.Errorf("expected bad trailer, got %v", countErr)
+	}
+
+	fileHeaderSize := len(fileFormatHeaderWithVersion(FileFormatVersion))
+	wrongLength := append([]byte{}, octets...)
+	wrongLength[fileHeaderSize+7]--
+	wrongLength[fileHeaderSize+chunkHeaderOctetCount+len("chunk 0")+7]++
+	iterator, iteratorErr := NewReverseIterator(bytes.NewReader(wrongLength))
+	if iteratorErr != nil {
+		t.Fatal(iteratorErr)
+	}
+	var nextErr error
+	for nextErr == nil {
+		_, _, nextErr = iterator.Next()
+	}
+	if !errors.Is(nextErr, ErrBadTrailer) {
+		t.Errorf("expected bad trailer, got %v", nextErr)
+	}
+}
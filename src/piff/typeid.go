@@ -45,7 +45,7 @@ func (t TypeID) IsEqualString(b string) bool {
 
 func NewTypeIDFromOctets(payload []byte) (TypeID, error) {
 	if len(payload) != 4 {
-		return TypeID{}, fmt.Errorf("typeid: payload must be exactly four octets.")
+		return TypeID{}, fmt.Errorf("%w: payload must be exactly four octets, was %d", ErrInvalidTypeID, len(payload))
 	}
 
 	return TypeID{
@@ -55,3 +55,15 @@ func NewTypeIDFromOctets(payload []byte) (TypeID, error) {
 		payload[3],
 	}, nil
 }
+
+func NewTypeIDFromString(typeID string) (TypeID, error) {
+	if len(typeID) != 4 {
+		return TypeID{}, fmt.Errorf("%w: '%v' must be exactly four octets", ErrInvalidTypeID, typeID)
+	}
+
+	return NewTypeIDFromOctets([]byte(typeID))
+}
+
+func (t TypeID) String() string {
+	return string(t[0:])
+}
@@ -0,0 +1,148 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"fmt"
+
+	"github.com/piot/brook-go/src/instream"
+	"github.com/piot/brook-go/src/outstream"
+)
+
+// The type registry chunk describes the type ids used in a file. Each entry
+// is the four octet type id followed by length prefixed name, description
+// and payload encoding.
+var TypeRegistryTypeID = TypeID{'r', 'e', 'g', '1'}
+
+type PayloadEncoding string
+
+const (
+	PayloadEncodingBinary    PayloadEncoding = "binary"
+	PayloadEncodingText      PayloadEncoding = "text"
+	PayloadEncodingJSON      PayloadEncoding = "json"
+	PayloadEncodingMetadata  PayloadEncoding = "metadata"
+	PayloadEncodingTimestamp PayloadEncoding = "timestamp"
+	PayloadEncodingRegistry  PayloadEncoding = "registry"
+)
+
+type TypeInfo struct {
+	TypeID      TypeID
+	Name        string
+	Description string
+	Encoding    PayloadEncoding
+}
+
+func (i TypeInfo) String() string {
+	return fmt.Sprintf("[typeinfo '%v' name:%v encoding:%v]", i.TypeID, i.Name, i.Encoding)
+}
+
+type TypeRegistry struct {
+	infos   []TypeInfo
+	indices map[TypeID]int
+}
+
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{indices: make(map[TypeID]int)}
+}
+
+// NewStandardTypeRegistry returns a registry that describes the chunk types
+// defined by piff itself.
+func NewStandardTypeRegistry() *TypeRegistry {
+	r := NewTypeRegistry()
+	r.Add(TypeInfo{TypeID: MetadataTypeID, Name: "metadata", Description: "file metadata", Encoding: PayloadEncodingMetadata})
+	r.Add(TypeInfo{TypeID: TypeRegistryTypeID, Name: "type registry", Description: "descriptions of the type ids in the file", Encoding: PayloadEncodingRegistry})
+	r.Add(TypeInfo{TypeID: TimestampTypeID, Name: "timestamp", Description: "time since the start of the recording", Encoding: PayloadEncodingTimestamp})
+	r.Add(TypeInfo{TypeID: TrailerTypeID, Name: "trailer", Description: "octet count of every chunk, for reading backwards", Encoding: PayloadEncodingBinary})
+	return r
+}
+
+// Add replaces any earlier info for the same type id.
+func (r *TypeRegistry) Add(info TypeInfo) {
+	index, wasFound := r.indices[info.TypeID]
+	if wasFound {
+		r.infos[index] = info
+		return
+	}
+	r.indices[info.TypeID] = len(r.infos)
+	r.infos = append(r.infos, info)
+}
+
+func (r *TypeRegistry) Merge(other *TypeRegistry) {
+	for _, info := range other.infos {
+		r.Add(info)
+	}
+}
+
+func (r *TypeRegistry) Lookup(typeID TypeID) (TypeInfo, bool) {
+	index, wasFound := r.indices[typeID]
+	if !wasFound {
+		return TypeInfo{}, false
+	}
+	return r.infos[index], true
+}
+
+func (r *TypeRegistry) Infos() []TypeInfo {
+	return append([]TypeInfo(nil), r.infos...)
+}
+
+func (r *TypeRegistry) Octets() []byte {
+	s := outstream.New()
+	s.WriteUint32(uint32(len(r.infos)))
+	for _, info := range r.infos {
+		s.WriteOctets(info.TypeID[:])
+		writeLengthPrefixedString(s, info.Name)
+		writeLengthPrefixedString(s, info.Description)
+		writeLengthPrefixedString(s, string(info.Encoding))
+	}
+	return s.Octets()
+}
+
+func NewTypeRegistryFromOctets(payload []byte) (*TypeRegistry, error) {
+	s := instream.New(payload)
+	infoCount, countErr := s.ReadUint32()
+	if countErr != nil {
+		return nil, fmt.Errorf("%w: entry count: %v", ErrInvalidRegistry, countErr)
+	}
+	r := NewTypeRegistry()
+	for i := uint32(0); i < infoCount; i++ {
+		typeIDOctets, typeIDErr := s.ReadOctets(4)
+		if typeIDErr != nil {
+			return nil, fmt.Errorf("%w: entry %d: %v", ErrInvalidRegistry, i, typeIDErr)
+		}
+		typeID, _ := NewTypeIDFromOctets(typeIDOctets)
+		var fields [3]string
+		for fieldIndex := range fields {
+			field, fieldErr := readLengthPrefixedString(s, len(payload))
+			if fieldErr != nil {
+				return nil, fmt.Errorf("%w: entry '%v': %v", ErrInvalidRegistry, typeID, fieldErr)
+			}
+			fields[fieldIndex] = field
+		}
+		r.Add(TypeInfo{TypeID: typeID, Name: fields[0], Description: fields[1], Encoding: PayloadEncoding(fields[2])})
+	}
+	return r, nil
+}
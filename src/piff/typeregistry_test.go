@@ -0,0 +1,76 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTypeRegistry(t *testing.T) {
+	schemaTypeID, _ := NewTypeIDFromString("sch1")
+	packetTypeID, _ := NewTypeIDFromString("pkt1")
+	registry := NewTypeRegistry()
+	registry.Add(TypeInfo{TypeID: schemaTypeID, Name: "schema", Description: "entity schema", Encoding: PayloadEncodingText})
+	registry.Add(TypeInfo{TypeID: packetTypeID, Name: "packet", Encoding: PayloadEncodingBinary})
+	registry.Add(TypeInfo{TypeID: packetTypeID, Name: "packet", Description: "game packet", Encoding: PayloadEncodingBinary})
+
+	var buf bytes.Buffer
+	f, _ := NewOutStreamWriter(&buf)
+	f.WriteTypeRegistry(registry)
+	f.WriteChunk(schemaTypeID, []byte("enum Some"))
+
+	seeker, seekerErr := NewInSeeker(bytes.NewReader(buf.Bytes()))
+	if seekerErr != nil {
+		t.Fatal(seekerErr)
+	}
+	readRegistry, registryErr := seeker.TypeRegistry()
+	if registryErr != nil {
+		t.Fatal(registryErr)
+	}
+	infos := readRegistry.Infos()
+	if len(infos) != 2 || infos[0].TypeID != schemaTypeID {
+		t.Fatalf("wrong infos %v", infos)
+	}
+	packetInfo, wasFound := readRegistry.Lookup(packetTypeID)
+	if !wasFound || packetInfo.Description != "game packet" {
+		t.Errorf("later add should replace the info %v", packetInfo)
+	}
+
+	standard := NewStandardTypeRegistry()
+	standard.Merge(readRegistry)
+	if _, hasTimestamp := standard.Lookup(TimestampTypeID); !hasTimestamp {
+		t.Errorf("standard registry should know timestamps")
+	}
+	if _, hasSchema := standard.Lookup(schemaTypeID); !hasSchema {
+		t.Errorf("merged registry should know the schema")
+	}
+
+	if _, brokenErr := NewTypeRegistryFromOctets(registry.Octets()[:20]); brokenErr == nil {
+		t.Errorf("expected error for a truncated registry")
+	}
+}
@@ -0,0 +1,204 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/piot/brook-go/src/instream"
+)
+
+type ValidationErrorKind int
+
+const (
+	ValidationBadFileHeader ValidationErrorKind = iota + 1
+	ValidationUnsupportedVersion
+	ValidationTruncatedChunk
+	ValidationTrailingGarbage
+	ValidationReadError
+)
+
+func (k ValidationErrorKind) String() string {
+	switch k {
+	case ValidationBadFileHeader:
+		return "bad file header"
+	case ValidationUnsupportedVersion:
+		return "unsupported version"
+	case ValidationTruncatedChunk:
+		return "truncated chunk"
+	case ValidationTrailingGarbage:
+		return "trailing garbage"
+	case ValidationReadError:
+		return "read error"
+	}
+	return fmt.Sprintf("unknown validation error %d", int(k))
+}
+
+type ValidationError struct {
+	Kind       ValidationErrorKind
+	Offset     int64
+	ChunkIndex ChunkIndex
+	Message    string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("piff: %v at offset %d (chunk %d): %v", e.Kind, e.Offset, e.ChunkIndex, e.Message)
+}
+
+var validationErrorSentinels = map[ValidationErrorKind]error{
+	ValidationBadFileHeader:      ErrBadMagic,
+	ValidationUnsupportedVersion: ErrUnsupportedVersion,
+	ValidationTruncatedChunk:     ErrTruncated,
+	ValidationTrailingGarbage:    ErrTrailingGarbage,
+}
+
+// Unwrap returns nil for ValidationReadError.
+func (e *ValidationError) Unwrap() error {
+	return validationErrorSentinels[e.Kind]
+}
+
+type ValidationReport struct {
+	Format     FileFormat
+	ChunkCount int
+	OctetCount int64
+}
+
+func (r ValidationReport) String() string {
+	return fmt.Sprintf("[validationreport format:%v chunks:%v octets:%v]", r.Format, r.ChunkCount, r.OctetCount)
+}
+
+const chunkHeaderOctetCount = 8
+
+func validateFileHeader(reader io.Reader, fileSize int64) error {
+	expectedHeader := fileFormatHeaderWithVersion(FileFormatVersion)
+	fileHeaderPayload := make([]byte, len(expectedHeader))
+	octetsRead, readErr := io.ReadFull(reader, fileHeaderPayload)
+	if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+		return &ValidationError{Kind: ValidationReadError, Offset: int64(octetsRead), Message: readErr.Error()}
+	}
+	magic := fileFormatHeader()
+	for i := 0; i < len(magic); i++ {
+		if i >= octetsRead {
+			return &ValidationError{Kind: ValidationBadFileHeader, Offset: int64(i),
+				Message: fmt.Sprintf("file is only %d octets, file header needs %d", fileSize, len(expectedHeader))}
+		}
+		if fileHeaderPayload[i] != magic[i] {
+			return &ValidationError{Kind: ValidationBadFileHeader, Offset: int64(i),
+				Message: fmt.Sprintf("expected %02X but found %02X", magic[i], fileHeaderPayload[i])}
+		}
+	}
+	versionOffset := len(magic)
+	if octetsRead <= versionOffset {
+		return &ValidationError{Kind: ValidationBadFileHeader, Offset: int64(versionOffset),
+			Message: "file header is missing the version octet"}
+	}
+	if !bytes.Equal(fileHeaderPayload, expectedHeader) {
+		return &ValidationError{Kind: ValidationUnsupportedVersion, Offset: int64(versionOffset),
+			Message: fmt.Sprintf("version %d is not supported, expected %d", fileHeaderPayload[versionOffset], FileFormatVersion)}
+	}
+
+	return nil
+}
+
+// Validate detects the file format the same way InStream does, and then
+// validates the file like ValidateWithFormat.
+func Validate(readSeeker io.ReadSeeker) (ValidationReport, error) {
+	return ValidateWithFormat(readSeeker, FileFormatAuto)
+}
+
+// ValidateWithFormat walks the whole stream and checks that the file header,
+// unless the file is headerless, every chunk header and every chunk length is
+// consistent with the stream size. Files that are not detected as either
+// format are checked as piff files, which tells what is wrong with the file
+// header. The returned error is always a *ValidationError.
+func ValidateWithFormat(readSeeker io.ReadSeeker, format FileFormat) (ValidationReport, error) {
+	fileSize, sizeErr := readSeeker.Seek(0, io.SeekEnd)
+	if sizeErr != nil {
+		return ValidationReport{}, &ValidationError{Kind: ValidationReadError, Message: sizeErr.Error()}
+	}
+	if _, seekErr := readSeeker.Seek(0, io.SeekStart); seekErr != nil {
+		return ValidationReport{}, &ValidationError{Kind: ValidationReadError, Message: seekErr.Error()}
+	}
+
+	report := ValidationReport{OctetCount: fileSize}
+	if format == FileFormatAuto {
+		detected, detectErr := DetectFileFormat(readSeeker)
+		var chunkErr *ChunkError
+		if detectErr != nil && !errors.As(detectErr, &chunkErr) {
+			return report, &ValidationError{Kind: ValidationReadError, Message: detectErr.Error()}
+		}
+		format = FileFormatPiff
+		if detectErr == nil {
+			format = detected.Format
+		}
+	}
+	report.Format = format
+
+	var tell int64
+	switch format {
+	case FileFormatPiff:
+		if headerErr := validateFileHeader(readSeeker, fileSize); headerErr != nil {
+			return report, headerErr
+		}
+		tell = int64(len(fileFormatHeaderWithVersion(FileFormatVersion)))
+	case FileFormatHeaderless:
+	default:
+		return report, &ValidationError{Kind: ValidationBadFileHeader, Message: fmt.Sprintf("unknown file format %d", int(format))}
+	}
+
+	var chunkIndex ChunkIndex
+	for tell < fileSize {
+		remaining := fileSize - tell
+		if remaining < chunkHeaderOctetCount {
+			return report, &ValidationError{Kind: ValidationTrailingGarbage, Offset: tell, ChunkIndex: chunkIndex,
+				Message: fmt.Sprintf("%d octets left, too few for a chunk header", remaining)}
+		}
+		headerOctets := make([]byte, chunkHeaderOctetCount)
+		if _, readErr := io.ReadFull(readSeeker, headerOctets); readErr != nil {
+			return report, &ValidationError{Kind: ValidationReadError, Offset: tell, ChunkIndex: chunkIndex, Message: readErr.Error()}
+		}
+		s := instream.New(headerOctets)
+		typeID, _ := s.ReadOctets(4)
+		octetCount, _ := s.ReadUint32()
+		payloadEnd := tell + chunkHeaderOctetCount + int64(octetCount)
+		if payloadEnd > fileSize {
+			return report, &ValidationError{Kind: ValidationTruncatedChunk, Offset: tell, ChunkIndex: chunkIndex,
+				Message: fmt.Sprintf("chunk '%v' claims %d octets, ends at %d but file size is %d", string(typeID), octetCount, payloadEnd, fileSize)}
+		}
+		if _, seekErr := readSeeker.Seek(payloadEnd, io.SeekStart); seekErr != nil {
+			return report, &ValidationError{Kind: ValidationReadError, Offset: tell, ChunkIndex: chunkIndex, Message: seekErr.Error()}
+		}
+		tell = payloadEnd
+		chunkIndex++
+		report.ChunkCount++
+	}
+
+	return report, nil
+}
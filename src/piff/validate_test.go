@@ -0,0 +1,99 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func expectValidationKind(t *testing.T, octets []byte, kind ValidationErrorKind, offset int64) {
+	_, err := Validate(bytes.NewReader(octets))
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if validationErr.Kind != kind {
+		t.Errorf("wrong kind %v, expected %v", validationErr.Kind, kind)
+	}
+	if validationErr.Offset != offset {
+		t.Errorf("wrong offset %v, expected %v", validationErr.Offset, offset)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	octets := writeTestChunks(t, 3)
+	report, err := Validate(bytes.NewReader(octets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ChunkCount != 3 {
+		t.Errorf("wrong chunk count %v", report.ChunkCount)
+	}
+}
+
+func TestValidateBroken(t *testing.T) {
+	octets := writeTestChunks(t, 2)
+	fileHeaderSize := int64(len(fileFormatHeaderWithVersion(FileFormatVersion)))
+	chunkSize := int64(chunkHeaderOctetCount + len("some payload"))
+
+	badMagic := append([]byte{}, octets...)
+	badMagic[4] = 'X'
+	expectValidationKind(t, badMagic, ValidationBadFileHeader, 4)
+
+	badVersion := append([]byte{}, octets...)
+	badVersion[fileHeaderSize-1] = FileFormatVersion + 1
+	expectValidationKind(t, badVersion, ValidationUnsupportedVersion, fileHeaderSize-1)
+
+	expectValidationKind(t, octets[:len(octets)-1], ValidationTruncatedChunk, fileHeaderSize+chunkSize)
+
+	garbage := append(append([]byte{}, octets...), 1, 2, 3)
+	expectValidationKind(t, garbage, ValidationTrailingGarbage, fileHeaderSize+chunkSize*2)
+}
+
+func TestValidateHeaderless(t *testing.T) {
+	octets, readErr := ioutil.ReadFile("../../bin/c61_short.ibdf")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	report, err := Validate(bytes.NewReader(octets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Format != FileFormatHeaderless || report.ChunkCount != 54 {
+		t.Errorf("wrong report %v", report)
+	}
+
+	expectValidationKind(t, octets[:len(octets)-1], ValidationTruncatedChunk, int64(len(octets)-18))
+	garbage := append(append([]byte{}, octets...), 1, 2, 3)
+	expectValidationKind(t, garbage, ValidationTrailingGarbage, int64(len(octets)))
+
+	if _, piffErr := ValidateWithFormat(bytes.NewReader(octets), FileFormatPiff); piffErr == nil {
+		t.Errorf("a headerless file should not validate as a piff file")
+	}
+}
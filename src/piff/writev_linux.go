@@ -0,0 +1,99 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// maxIovecCount is IOV_MAX on Linux.
+const maxIovecCount = 1024
+
+// writeVectored writes the buffers with writev, up to maxIovecCount at a time.
+// It returns the number of octets written, also when it fails.
+func writeVectored(file *os.File, buffers net.Buffers) (int64, error) {
+	rawConn, connErr := file.SyscallConn()
+	if connErr != nil {
+		return buffers.WriteTo(file)
+	}
+	var writtenOctetCount int64
+	iovecs := make([]syscall.Iovec, 0, maxIovecCount)
+	for len(buffers) > 0 {
+		iovecs = iovecs[:0]
+		for _, buffer := range buffers {
+			if len(iovecs) == maxIovecCount {
+				break
+			}
+			if len(buffer) == 0 {
+				continue
+			}
+			iovec := syscall.Iovec{Base: &buffer[0]}
+			iovec.SetLen(len(buffer))
+			iovecs = append(iovecs, iovec)
+		}
+		if len(iovecs) == 0 {
+			return writtenOctetCount, nil
+		}
+
+		var written uintptr
+		var errno syscall.Errno
+		controlErr := rawConn.Write(func(fd uintptr) bool {
+			written, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)))
+			return errno != syscall.EAGAIN
+		})
+		if controlErr != nil {
+			return writtenOctetCount, controlErr
+		}
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return writtenOctetCount, &os.PathError{Op: "writev", Path: file.Name(), Err: errno}
+		}
+		if written == 0 {
+			return writtenOctetCount, io.ErrShortWrite
+		}
+		writtenOctetCount += int64(written)
+		buffers = consumeBuffers(buffers, int(written))
+	}
+	return writtenOctetCount, nil
+}
+
+func consumeBuffers(buffers net.Buffers, octetCount int) net.Buffers {
+	for len(buffers) > 0 && octetCount >= len(buffers[0]) {
+		octetCount -= len(buffers[0])
+		buffers = buffers[1:]
+	}
+	if len(buffers) > 0 {
+		buffers[0] = buffers[0][octetCount:]
+	}
+	return buffers
+}
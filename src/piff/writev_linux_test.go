@@ -0,0 +1,95 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package piff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestWriteVectoredManyBuffers(t *testing.T) {
+	file, createErr := ioutil.TempFile("", "writev")
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var buffers net.Buffers
+	var expected []byte
+	for i := 0; i < 3*maxIovecCount+10; i++ {
+		buffer := bytes.Repeat([]byte{byte(i)}, 1+i%3)
+		buffers = append(buffers, buffer)
+		expected = append(expected, buffer...)
+	}
+	writtenOctetCount, writeErr := writeVectored(file, buffers)
+	if writeErr != nil || writtenOctetCount != int64(len(expected)) {
+		t.Fatalf("wrote %d of %d octets, %v", writtenOctetCount, len(expected), writeErr)
+	}
+	written, readErr := ioutil.ReadFile(file.Name())
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if !bytes.Equal(written, expected) {
+		t.Errorf("written octets differ")
+	}
+}
+
+func TestWriteChunksVectoredWriter(t *testing.T) {
+	chunks := make([]OutChunk, maxIovecCount)
+	for i := range chunks {
+		chunks[i] = OutChunk{TypeID: TimestampTypeID, Payload: bytes.Repeat([]byte{byte(i)}, coalescePayloadOctetCount+i%7)}
+	}
+	expected := writeTestFile(t, OutStreamOptions{}, chunks)
+
+	file, createErr := ioutil.TempFile("", "writev")
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	outStream, outErr := NewOutStreamWriter(file)
+	if outErr != nil {
+		t.Fatal(outErr)
+	}
+	if outStream.vectorFile != file {
+		t.Fatalf("files should be written with writev")
+	}
+	if writeErr := outStream.WriteChunks(chunks); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	written, readErr := ioutil.ReadFile(file.Name())
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if !bytes.Equal(written, expected) {
+		t.Errorf("chunks written with writev differ")
+	}
+}
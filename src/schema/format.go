@@ -0,0 +1,61 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+func writeFields(builder *strings.Builder, fields []*Field) {
+	for _, field := range fields {
+		fmt.Fprintf(builder, "  %v %v\n", field.Name, field.TypeName)
+	}
+}
+
+// Format writes the schema in the canonical layout: two space indentation
+// and one empty line between declarations.
+func Format(s *Schema) string {
+	var builder strings.Builder
+	for i, declaration := range s.Declarations {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		fmt.Fprintf(&builder, "%v %v\n", declaration.Kind(), declaration.Name())
+		switch typed := declaration.(type) {
+		case *Enum:
+			for _, value := range typed.Values {
+				fmt.Fprintf(&builder, "  %v %d\n", value.Name, value.Value)
+			}
+		case *Component:
+			writeFields(&builder, typed.Fields)
+		case *Entity:
+			writeFields(&builder, typed.Fields)
+		}
+	}
+	return builder.String()
+}
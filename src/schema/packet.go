@@ -0,0 +1,65 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/piot/brook-go/src/instream"
+)
+
+const PacketTypeIDString = "pkt1"
+
+// A pkt1 payload starts with an octet of flags and the send time as unsigned
+// 64 bit milliseconds since the unix epoch. The layout of the body after it
+// is not known, so it is left undecoded.
+const packetHeaderOctetCount = 1 + 8
+
+type PacketHeader struct {
+	Flags uint8
+	Time  time.Time
+}
+
+// DecodePacketHeader returns the packet header and the undecoded body.
+func DecodePacketHeader(payload []byte) (PacketHeader, []byte, error) {
+	if len(payload) < packetHeaderOctetCount {
+		return PacketHeader{}, nil, fmt.Errorf("schema: packet of %d octets is shorter than the %d octet header", len(payload), packetHeaderOctetCount)
+	}
+	s := instream.New(payload)
+	flags, _ := s.ReadUint8()
+	milliseconds, _ := s.ReadUint64()
+	header := PacketHeader{
+		Flags: flags,
+		Time:  time.Unix(int64(milliseconds/1000), int64(milliseconds%1000)*int64(time.Millisecond)),
+	}
+	return header, payload[packetHeaderOctetCount:], nil
+}
+
+func (h PacketHeader) String() string {
+	return fmt.Sprintf("packet flags:%02X time:%v", h.Flags, h.Time.UTC().Format(time.RFC3339Nano))
+}
@@ -0,0 +1,77 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestDecodeSamplePacketHeaders(t *testing.T) {
+	octets, readErr := ioutil.ReadFile("../../bin/c61_short.ibdf")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	recordingDay := time.Date(2019, 5, 9, 0, 0, 0, 0, time.UTC)
+	var previous time.Time
+	packetCount := 0
+	for len(octets) > 0 {
+		typeID := string(octets[0:4])
+		octetCount := binary.BigEndian.Uint32(octets[4:8])
+		payload := octets[8 : 8+octetCount]
+		octets = octets[8+octetCount:]
+		if typeID != PacketTypeIDString {
+			continue
+		}
+		header, body, decodeErr := DecodePacketHeader(payload)
+		if decodeErr != nil {
+			t.Fatalf("packet %d: %v", packetCount, decodeErr)
+		}
+		if len(body) != len(payload)-packetHeaderOctetCount {
+			t.Errorf("packet %d: wrong body length %d", packetCount, len(body))
+		}
+		if header.Time.Before(recordingDay) || header.Time.After(recordingDay.Add(24*time.Hour)) {
+			t.Errorf("packet %d: time %v is not from the day of the recording", packetCount, header.Time)
+		}
+		if header.Time.Before(previous) {
+			t.Errorf("packet %d: time %v is before the previous packet", packetCount, header.Time)
+		}
+		previous = header.Time
+		packetCount++
+	}
+	if packetCount != 53 {
+		t.Errorf("expected 53 packets, got %d", packetCount)
+	}
+}
+
+func TestDecodeShortPacket(t *testing.T) {
+	if _, _, decodeErr := DecodePacketHeader([]byte{0x81, 0, 0}); decodeErr == nil {
+		t.Errorf("a packet shorter than the header should fail")
+	}
+}
@@ -0,0 +1,158 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The schema language is line based. A declaration starts at column one with
+// a keyword and a name, and its members follow on indented lines:
+//
+//	enum RadiusState
+//	  Neutral 1
+//
+//	component Radius
+//	  size Float
+//	  state RadiusState
+//
+//	entity Blob
+//	  radius Radius
+
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		isLetter := unicode.IsLetter(r) || r == '_'
+		if !isLetter && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+type parser struct {
+	schema     *Schema
+	enum       *Enum
+	fieldOwner *[]*Field
+}
+
+func newError(position Position, format string, args ...interface{}) *Error {
+	return &Error{Position: position, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseDeclaration(tokens []string, position Position) error {
+	if len(tokens) != 2 {
+		return newError(position, "expected '<enum|component|entity> <Name>'")
+	}
+	name := tokens[1]
+	if !isIdentifier(name) {
+		return newError(position, "'%v' is not a valid name", name)
+	}
+	p.enum = nil
+	p.fieldOwner = nil
+	switch tokens[0] {
+	case "enum":
+		p.enum = &Enum{name: name, position: position}
+		p.schema.Declarations = append(p.schema.Declarations, p.enum)
+	case "component":
+		component := &Component{name: name, position: position}
+		p.fieldOwner = &component.Fields
+		p.schema.Declarations = append(p.schema.Declarations, component)
+	case "entity":
+		entity := &Entity{name: name, position: position}
+		p.fieldOwner = &entity.Fields
+		p.schema.Declarations = append(p.schema.Declarations, entity)
+	default:
+		return newError(position, "unknown keyword '%v'", tokens[0])
+	}
+	return nil
+}
+
+func (p *parser) parseMember(tokens []string, position Position) error {
+	if p.enum == nil && p.fieldOwner == nil {
+		return newError(position, "indented line outside of a declaration")
+	}
+	if len(tokens) != 2 {
+		if p.enum != nil {
+			return newError(position, "expected '<Name> <value>'")
+		}
+		return newError(position, "expected '<name> <Type>'")
+	}
+	if !isIdentifier(tokens[0]) {
+		return newError(position, "'%v' is not a valid name", tokens[0])
+	}
+	if p.enum != nil {
+		value, valueErr := strconv.Atoi(tokens[1])
+		if valueErr != nil {
+			return newError(position, "enum value '%v' is not an integer", tokens[1])
+		}
+		p.enum.Values = append(p.enum.Values, &EnumValue{Name: tokens[0], Value: value, Position: position})
+		return nil
+	}
+	if !isIdentifier(tokens[1]) {
+		return newError(position, "'%v' is not a valid type name", tokens[1])
+	}
+	*p.fieldOwner = append(*p.fieldOwner, &Field{Name: tokens[0], TypeName: tokens[1], Position: position})
+	return nil
+}
+
+// Parse only checks the syntax, use Validate to check the type references.
+func Parse(source string) (*Schema, error) {
+	p := &parser{schema: &Schema{}}
+	for lineIndex, line := range strings.Split(source, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		position := Position{Line: lineIndex + 1, Column: indent + 1}
+		tokens := strings.Fields(line)
+		var lineErr error
+		if indent == 0 {
+			lineErr = p.parseDeclaration(tokens, position)
+		} else {
+			lineErr = p.parseMember(tokens, position)
+		}
+		if lineErr != nil {
+			return nil, lineErr
+		}
+	}
+	return p.schema, nil
+}
+
+func ParseAndValidate(source string) (*Schema, error) {
+	s, parseErr := Parse(source)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if validateErr := Validate(s); validateErr != nil {
+		return nil, validateErr
+	}
+	return s, nil
+}
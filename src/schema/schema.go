@@ -0,0 +1,198 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+import "fmt"
+
+const TypeIDString = "sch1"
+
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+type DeclarationKind int
+
+const (
+	EnumKind DeclarationKind = iota
+	ComponentKind
+	EntityKind
+)
+
+func (k DeclarationKind) String() string {
+	switch k {
+	case EnumKind:
+		return "enum"
+	case ComponentKind:
+		return "component"
+	case EntityKind:
+		return "entity"
+	}
+	return fmt.Sprintf("unknown kind %d", int(k))
+}
+
+type Declaration interface {
+	Kind() DeclarationKind
+	Name() string
+	Position() Position
+}
+
+type EnumValue struct {
+	Name     string
+	Value    int
+	Position Position
+}
+
+type Enum struct {
+	name     string
+	position Position
+	Values   []*EnumValue
+}
+
+func (e *Enum) Kind() DeclarationKind {
+	return EnumKind
+}
+
+func (e *Enum) Name() string {
+	return e.name
+}
+
+func (e *Enum) Position() Position {
+	return e.position
+}
+
+type Field struct {
+	Name     string
+	TypeName string
+	Position Position
+}
+
+type Component struct {
+	name     string
+	position Position
+	Fields   []*Field
+}
+
+func (c *Component) Kind() DeclarationKind {
+	return ComponentKind
+}
+
+func (c *Component) Name() string {
+	return c.name
+}
+
+func (c *Component) Position() Position {
+	return c.position
+}
+
+type Entity struct {
+	name     string
+	position Position
+	Fields   []*Field
+}
+
+func (e *Entity) Kind() DeclarationKind {
+	return EntityKind
+}
+
+func (e *Entity) Name() string {
+	return e.name
+}
+
+func (e *Entity) Position() Position {
+	return e.position
+}
+
+// Schema keeps the declarations in source order.
+type Schema struct {
+	Declarations []Declaration
+}
+
+func (s *Schema) Lookup(name string) Declaration {
+	for _, declaration := range s.Declarations {
+		if declaration.Name() == name {
+			return declaration
+		}
+	}
+	return nil
+}
+
+func (s *Schema) Enums() []*Enum {
+	var enums []*Enum
+	for _, declaration := range s.Declarations {
+		if enum, isEnum := declaration.(*Enum); isEnum {
+			enums = append(enums, enum)
+		}
+	}
+	return enums
+}
+
+func (s *Schema) Components() []*Component {
+	var components []*Component
+	for _, declaration := range s.Declarations {
+		if component, isComponent := declaration.(*Component); isComponent {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+func (s *Schema) Entities() []*Entity {
+	var entities []*Entity
+	for _, declaration := range s.Declarations {
+		if entity, isEntity := declaration.(*Entity); isEntity {
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+type Error struct {
+	Position Position
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema: %v: %v", e.Position, e.Message)
+}
+
+type Errors []*Error
+
+func (e Errors) Error() string {
+	text := ""
+	for i, err := range e {
+		if i > 0 {
+			text += "\n"
+		}
+		text += err.Error()
+	}
+	return text
+}
@@ -0,0 +1,124 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// sampleSchema returns the payload of the first chunk in the bundled sample,
+// which starts directly with the chunk header.
+func sampleSchema(t *testing.T) string {
+	octets, readErr := ioutil.ReadFile("../../bin/c61_short.ibdf")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if string(octets[0:4]) != TypeIDString {
+		t.Fatalf("sample should start with a schema chunk")
+	}
+	octetCount := binary.BigEndian.Uint32(octets[4:8])
+	return string(octets[8 : 8+octetCount])
+}
+
+func TestParseSample(t *testing.T) {
+	source := sampleSchema(t)
+	s, err := ParseAndValidate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Enums()) != 1 || len(s.Components()) != 2 || len(s.Entities()) != 1 {
+		t.Fatalf("wrong declarations %v", s.Declarations)
+	}
+	radius := s.Lookup("Radius").(*Component)
+	if len(radius.Fields) != 3 || radius.Fields[1].TypeName != "RadiusState" || radius.Fields[1].Position.Line != 6 {
+		t.Errorf("wrong Radius component %v", radius.Fields)
+	}
+	neutral := s.Enums()[0].Values[0]
+	if neutral.Name != "Neutral" || neutral.Value != 1 {
+		t.Errorf("wrong enum value %v", neutral)
+	}
+	if Format(s) != source {
+		t.Errorf("format should reproduce the sample:\n%v", Format(s))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	sources := map[string]string{
+		"struct Some\n":                  "1:1",
+		"  size Float\n":                 "1:3",
+		"enum State\n  Neutral one\n":    "2:3",
+		"component Body\n  position\n":   "2:3",
+		"entity 9Lives\n":                "1:1",
+		"component Body\n  pos World!\n": "2:3",
+	}
+	for source, position := range sources {
+		_, err := Parse(source)
+		if err == nil || !strings.Contains(err.Error(), position) {
+			t.Errorf("expected error at %v for %q, got %v", position, source, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	source := `enum State
+  On 1
+  Off 1
+
+component Body
+  position WorldPosition
+  position Float
+  other Body
+
+entity Blob
+  body Body
+  missing Nothing
+  parent Blob
+
+component Float
+`
+	s, parseErr := Parse(source)
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	validateErr := Validate(s)
+	errors, isErrors := validateErr.(Errors)
+	if !isErrors {
+		t.Fatalf("expected Errors, got %v", validateErr)
+	}
+	expectedLines := []int{3, 7, 8, 12, 13, 15}
+	if len(errors) != len(expectedLines) {
+		t.Fatalf("wrong errors:\n%v", validateErr)
+	}
+	for i, line := range expectedLines {
+		if errors[i].Position.Line != line {
+			t.Errorf("expected error on line %d, got %v", line, errors[i])
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+
+MIT License
+
+Copyright (c) 2019 Peter Bjorklund
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+
+*/
+
+package schema
+
+var builtinTypeNames = []string{
+	"Bool",
+	"Int",
+	"UInt8",
+	"UInt16",
+	"UInt32",
+	"Float",
+	"String",
+	"WorldPosition",
+}
+
+func IsBuiltinType(name string) bool {
+	for _, builtinName := range builtinTypeNames {
+		if builtinName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func BuiltinTypeNames() []string {
+	return append([]string(nil), builtinTypeNames...)
+}
+
+type validator struct {
+	schema *Schema
+	errors Errors
+}
+
+func (v *validator) add(position Position, format string, args ...interface{}) {
+	v.errors = append(v.errors, newError(position, format, args...))
+}
+
+func (v *validator) validateEnum(enum *Enum) {
+	names := make(map[string]bool)
+	values := make(map[int]string)
+	for _, value := range enum.Values {
+		if names[value.Name] {
+			v.add(value.Position, "enum %v has '%v' more than once", enum.Name(), value.Name)
+		}
+		names[value.Name] = true
+		if otherName, isTaken := values[value.Value]; isTaken {
+			v.add(value.Position, "enum %v uses value %d for both '%v' and '%v'", enum.Name(), value.Value, otherName, value.Name)
+			continue
+		}
+		values[value.Value] = value.Name
+	}
+}
+
+// Components may hold builtin and enum fields, entities may also hold
+// components.
+func (v *validator) validateFields(owner Declaration, fields []*Field) {
+	names := make(map[string]bool)
+	for _, field := range fields {
+		if names[field.Name] {
+			v.add(field.Position, "%v %v has field '%v' more than once", owner.Kind(), owner.Name(), field.Name)
+		}
+		names[field.Name] = true
+		if IsBuiltinType(field.TypeName) {
+			continue
+		}
+		referenced := v.schema.Lookup(field.TypeName)
+		if referenced == nil {
+			v.add(field.Position, "unknown type '%v' for field '%v'", field.TypeName, field.Name)
+			continue
+		}
+		switch referenced.Kind() {
+		case EnumKind:
+		case ComponentKind:
+			if owner.Kind() != EntityKind {
+				v.add(field.Position, "component %v can only be used in an entity, not in %v %v", referenced.Name(), owner.Kind(), owner.Name())
+			}
+		default:
+			v.add(field.Position, "%v %v can not be used as a field type", referenced.Kind(), referenced.Name())
+		}
+	}
+}
+
+// Validate returns Errors holding every problem found, or nil.
+func Validate(s *Schema) error {
+	v := &validator{schema: s}
+	declared := make(map[string]bool)
+	for _, declaration := range s.Declarations {
+		name := declaration.Name()
+		if IsBuiltinType(name) {
+			v.add(declaration.Position(), "'%v' is a builtin type and can not be declared", name)
+		} else if declared[name] {
+			v.add(declaration.Position(), "'%v' is declared more than once", name)
+		}
+		declared[name] = true
+
+		switch typed := declaration.(type) {
+		case *Enum:
+			v.validateEnum(typed)
+		case *Component:
+			v.validateFields(typed, typed.Fields)
+		case *Entity:
+			v.validateFields(typed, typed.Fields)
+		}
+	}
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}